@@ -2,7 +2,9 @@ package dto
 
 type (
 	Config struct {
-		LogLevel string `yaml:"log_level" default:"info"`
+		LogLevel string  `yaml:"log_level" default:"info"`
+		TimeZone string  `yaml:"timezone" default:"UTC"`
+		Owners   []int64 `yaml:"owners"` // ID владельцев бота, остальные роли назначаются командами
 		Bot      struct {
 			Token string `yaml:"token"`
 			Debug bool   `yaml:"debug"`
@@ -1,5 +0,0 @@
-package dto
-
-const (
-	GlobalAdminID = int64(53043564)
-)
@@ -19,7 +19,7 @@ func NewCron(
 	config dto.Config,
 	telegram *telegram.Telegram,
 ) (*Cron, error) {
-	timeLoc, err := time.LoadLocation("UTC")
+	timeLoc, err := time.LoadLocation(config.TimeZone)
 	if err != nil {
 		return nil, err
 	}
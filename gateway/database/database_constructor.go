@@ -61,14 +61,52 @@ func New(config dto.Config) (*Database, error) {
 	sqlDB.SetMaxOpenConns(150)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// Срок предупреждений по умолчанию задается группам, созданным до появления колонки
+	hasWarnExpire := db.Migrator().HasColumn(&ModeratedGroup{}, "warn_expire_hours")
+
 	// Автомиграция базы, тут нужно указать все модели
 	err = db.AutoMigrate(
 		&User{},
+		&UserNameHistory{},
+		&UserRole{},
+		&Chat{},
+		&ChatMember{},
+		&ModeratedGroup{},
+		&WhitelistedLink{},
+		&WhitelistedUser{},
+		&ScheduleWindow{},
+		&ScheduleException{},
+		&Stopword{},
+		&GlobalWhitelistEntry{},
+		&Warning{},
+		&ModerationAction{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = migrateLegacySchedule(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Старый уникальный индекс не учитывал тип записи белого списка
+	if db.Migrator().HasIndex(&WhitelistedLink{}, "idx_whitelisted_link") {
+		err = db.Migrator().DropIndex(&WhitelistedLink{}, "idx_whitelisted_link")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasWarnExpire {
+		err = db.Model(&ModeratedGroup{}).
+			Where("1 = 1").
+			Update("warn_expire_hours", DefaultWarnExpireHours).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Database{
 		db: db,
 	}, nil
@@ -77,3 +115,89 @@ func New(config dto.Config) (*Database, error) {
 func (d *Database) DB() *gorm.DB {
 	return d.db
 }
+
+// migrateLegacySchedule переносит старую пару close_time/open_time групп
+// в ежедневные окна расписания и удаляет устаревшие колонки
+func migrateLegacySchedule(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&ModeratedGroup{}, "close_time") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			ChatID    int64
+			CloseTime string
+			OpenTime  string
+		}
+		err := tx.Table("moderated_groups").
+			Select("chat_id, close_time, open_time").
+			Where("chat_id NOT IN (?)", tx.Model(&ScheduleWindow{}).Select("chat_id")).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.CloseTime == "" || row.OpenTime == "" {
+				continue
+			}
+
+			windows := DailyScheduleWindows(row.CloseTime, row.OpenTime)
+			for i := range windows {
+				windows[i].ChatID = row.ChatID
+			}
+
+			err = tx.Create(&windows).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Migrator().DropColumn(&ModeratedGroup{}, "close_time")
+		if err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&ModeratedGroup{}, "open_time")
+	})
+}
+
+// TypeLegacyWhitelistedLinks один раз проставляет тип записям белого списка ссылок, сохраненным
+// до появления типов. classify возвращает тип и нормализованную запись; разбор ссылок живет
+// в телеграм-модуле, поэтому передается оттуда. Запись, совпавшая после нормализации с уже
+// существующей, удаляется
+func (d *Database) TypeLegacyWhitelistedLinks(classify func(link string) (kind, pattern string)) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var links []WhitelistedLink
+		err := tx.Where("kind = ?", "").Find(&links).Error
+		if err != nil {
+			return err
+		}
+
+		for _, link := range links {
+			kind, pattern := classify(link.Link)
+
+			var count int64
+			err = tx.Model(&WhitelistedLink{}).
+				Where("chat_id = ? AND kind = ? AND link = ? AND id <> ?", link.ChatID, kind, pattern, link.ID).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+
+			if count > 0 {
+				err = tx.Delete(&WhitelistedLink{}, link.ID).Error
+			} else {
+				err = tx.Model(&WhitelistedLink{}).
+					Where("id = ?", link.ID).
+					Updates(map[string]interface{}{"kind": kind, "link": pattern}).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
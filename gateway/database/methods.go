@@ -1,5 +1,13 @@
 package database
 
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
 func (d *Database) GetUserByID(id int64) (*User, error) {
 	var user User
 	err := d.db.
@@ -22,3 +30,649 @@ func (d *Database) GetAllUserIDs() ([]int64, error) {
 
 	return ids, err
 }
+
+// GetUserByUsername ищет пользователя по юзернейму без учета регистра
+func (d *Database) GetUserByUsername(username string) (*User, error) {
+	var user User
+	err := d.db.
+		Where("LOWER(username) = LOWER(?)", username).
+		Order("updated_at DESC").
+		First(&user).Error
+	return &user, err
+}
+
+func (d *Database) GetUsersByIDs(ids []int64) ([]User, error) {
+	var users []User
+	err := d.db.
+		Where("id IN ?", ids).
+		Find(&users).Error
+
+	return users, err
+}
+
+// SaveUsers создает или обновляет пользователей одним запросом. Если имя или юзернейм
+// отличаются от сохраненных, новое значение записывается в историю имен
+func (d *Database) SaveUsers(users []User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var stored []User
+		err := tx.
+			Select("id", "first_name", "last_name", "username").
+			Where("id IN ?", ids).
+			Find(&stored).Error
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int64]User, len(stored))
+		for _, user := range stored {
+			known[user.ID] = user
+		}
+
+		var history []UserNameHistory
+		for _, user := range users {
+			old, ok := known[user.ID]
+			if ok && old.FirstName == user.FirstName && old.LastName == user.LastName && old.Username == user.Username {
+				continue
+			}
+
+			changedAt := time.Now()
+			if user.LastSeenAt != nil {
+				changedAt = *user.LastSeenAt
+			}
+			history = append(history, UserNameHistory{
+				UserID:    user.ID,
+				FirstName: user.FirstName,
+				LastName:  user.LastName,
+				Username:  user.Username,
+				ChangedAt: changedAt,
+			})
+		}
+
+		err = tx.
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "id"}},
+				DoUpdates: clause.AssignmentColumns([]string{
+					"first_name", "last_name", "username", "language_code", "is_bot", "is_premium", "last_seen_at", "updated_at",
+				}),
+			}).
+			Create(&users).Error
+		if err != nil {
+			return err
+		}
+
+		if len(history) == 0 {
+			return nil
+		}
+
+		return tx.Create(&history).Error
+	})
+}
+
+// GetUserNameHistory возвращает имена и юзернеймы пользователя, новые первыми
+func (d *Database) GetUserNameHistory(userID int64) ([]UserNameHistory, error) {
+	var history []UserNameHistory
+	err := d.db.
+		Where("user_id = ?", userID).
+		Order("changed_at DESC").
+		Find(&history).Error
+
+	return history, err
+}
+
+// GetModeratedGroup возвращает группу со всеми списками. Списки, которые команды выводят с номерами,
+// упорядочены, чтобы номер из вывода указывал на ту же запись при удалении
+func (d *Database) GetModeratedGroup(chatID int64) (*ModeratedGroup, error) {
+	var group ModeratedGroup
+	err := d.db.
+		Preload("WhitelistedLinks", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("WhitelistedUsers", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, user_id") }).
+		Preload("ScheduleWindows").
+		Preload("ScheduleExceptions").
+		Preload("Stopwords", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where(&ModeratedGroup{
+			ChatID: chatID,
+		}).
+		First(&group).Error
+	return &group, err
+}
+
+// IsNotFound проверяет, что запрошенной записи нет в базе
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+func (d *Database) HasModeratedGroup(chatID int64) (bool, error) {
+	var count int64
+	err := d.db.
+		Model(&ModeratedGroup{}).
+		Where("chat_id = ?", chatID).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// CreateModeratedGroup создает группу вместе с белыми списками, расписанием и запрещенными словами
+func (d *Database) CreateModeratedGroup(group *ModeratedGroup) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return createModeratedGroup(tx, group)
+	})
+}
+
+func createModeratedGroup(tx *gorm.DB, group *ModeratedGroup) error {
+	err := tx.Omit(clause.Associations).Create(group).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range group.WhitelistedLinks {
+		group.WhitelistedLinks[i].ID = 0
+		group.WhitelistedLinks[i].ChatID = group.ChatID
+	}
+	for i := range group.WhitelistedUsers {
+		group.WhitelistedUsers[i].ChatID = group.ChatID
+	}
+	for i := range group.ScheduleWindows {
+		group.ScheduleWindows[i].ID = 0
+		group.ScheduleWindows[i].ChatID = group.ChatID
+	}
+	for i := range group.ScheduleExceptions {
+		group.ScheduleExceptions[i].ID = 0
+		group.ScheduleExceptions[i].ChatID = group.ChatID
+	}
+	for i := range group.Stopwords {
+		group.Stopwords[i].ID = 0
+		group.Stopwords[i].ChatID = group.ChatID
+	}
+
+	err = createChildren(tx, &group.WhitelistedLinks, len(group.WhitelistedLinks))
+	if err != nil {
+		return err
+	}
+
+	err = createChildren(tx, &group.WhitelistedUsers, len(group.WhitelistedUsers))
+	if err != nil {
+		return err
+	}
+
+	err = createChildren(tx, &group.ScheduleWindows, len(group.ScheduleWindows))
+	if err != nil {
+		return err
+	}
+
+	err = createChildren(tx, &group.ScheduleExceptions, len(group.ScheduleExceptions))
+	if err != nil {
+		return err
+	}
+
+	return createChildren(tx, &group.Stopwords, len(group.Stopwords))
+}
+
+// createChildren создает дочерние записи группы, дубликаты пропускаются
+func createChildren(tx *gorm.DB, children interface{}, count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	return tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(children).Error
+}
+
+// SaveModeratedGroup сохраняет поля настроек группы, перечисленные в columns (имена полей структуры).
+// Остальные поля, белые списки, расписание и запрещенные слова не перезаписываются,
+// чтобы одновременные команды админов не затирали изменения друг друга
+func (d *Database) SaveModeratedGroup(group *ModeratedGroup, columns ...string) error {
+	if len(columns) == 0 {
+		return errors.New("no columns to save")
+	}
+
+	return d.db.
+		Model(&ModeratedGroup{ChatID: group.ChatID}).
+		Select(columns).
+		Updates(group).Error
+}
+
+// AddWhitelistedLink добавляет запись в белый список ссылок группы.
+// Возвращает false, если такая запись уже есть
+func (d *Database) AddWhitelistedLink(link *WhitelistedLink) (bool, error) {
+	result := d.db.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(link)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteWhitelistedLink удаляет запись белого списка ссылок группы. Возвращает false, если записи не было
+func (d *Database) DeleteWhitelistedLink(chatID int64, id uint) (bool, error) {
+	return deleteGroupRows(d.db, &WhitelistedLink{}, chatID, "id = ?", id)
+}
+
+// AddWhitelistedUser добавляет пользователя в доверенные группы. Возвращает false, если он уже там
+func (d *Database) AddWhitelistedUser(user *WhitelistedUser) (bool, error) {
+	result := d.db.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(user)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteWhitelistedUser убирает пользователя из доверенных группы. Возвращает false, если его там не было
+func (d *Database) DeleteWhitelistedUser(chatID, userID int64) (bool, error) {
+	return deleteGroupRows(d.db, &WhitelistedUser{}, chatID, "user_id = ?", userID)
+}
+
+// AddScheduleWindows добавляет окна закрытия группы
+func (d *Database) AddScheduleWindows(windows []ScheduleWindow) error {
+	if len(windows) == 0 {
+		return nil
+	}
+
+	return d.db.Create(&windows).Error
+}
+
+// DeleteScheduleWindow удаляет окно закрытия группы. Возвращает false, если окна не было
+func (d *Database) DeleteScheduleWindow(chatID int64, id uint) (bool, error) {
+	return deleteGroupRows(d.db, &ScheduleWindow{}, chatID, "id = ?", id)
+}
+
+// ClearScheduleWindows удаляет все окна закрытия группы
+func (d *Database) ClearScheduleWindows(chatID int64) error {
+	return d.db.
+		Where("chat_id = ?", chatID).
+		Delete(&ScheduleWindow{}).Error
+}
+
+// SaveScheduleException добавляет исключение расписания. Исключение на ту же дату заменяется
+func (d *Database) SaveScheduleException(exception *ScheduleException) error {
+	return d.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"closed", "note"}),
+		}).
+		Create(exception).Error
+}
+
+// DeleteScheduleException удаляет исключение расписания на дату. Возвращает false, если его не было
+func (d *Database) DeleteScheduleException(chatID int64, date string) (bool, error) {
+	return deleteGroupRows(d.db, &ScheduleException{}, chatID, "date = ?", date)
+}
+
+// SaveStopword добавляет запрещенное слово. У существующего слова заменяется действие
+func (d *Database) SaveStopword(stopword *Stopword) error {
+	return d.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "kind"}, {Name: "pattern"}},
+			DoUpdates: clause.AssignmentColumns([]string{"action", "duration"}),
+		}).
+		Create(stopword).Error
+}
+
+// DeleteStopword удаляет запрещенное слово группы. Возвращает false, если его не было
+func (d *Database) DeleteStopword(chatID int64, id uint) (bool, error) {
+	return deleteGroupRows(d.db, &Stopword{}, chatID, "id = ?", id)
+}
+
+// deleteGroupRows удаляет дочерние записи группы по условию. Возвращает false, если удалять было нечего
+func deleteGroupRows(db *gorm.DB, model interface{}, chatID int64, query string, args ...interface{}) (bool, error) {
+	result := db.
+		Where("chat_id = ?", chatID).
+		Where(query, args...).
+		Delete(model)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetEnabledModeratedGroups возвращает группы с включенной модерацией, кроме тех, откуда бот удален
+// или где он больше не администратор. Группы, где статус бота неизвестен, считаются активными
+func (d *Database) GetEnabledModeratedGroups() ([]*ModeratedGroup, error) {
+	inactive := d.db.
+		Model(&Chat{}).
+		Select("id").
+		Where("active = ? AND bot_status <> ?", false, "")
+
+	var groups []*ModeratedGroup
+	err := d.db.
+		Preload("WhitelistedLinks").
+		Preload("WhitelistedUsers").
+		Preload("ScheduleWindows").
+		Preload("ScheduleExceptions").
+		Preload("Stopwords").
+		Where("disabled = ?", false).
+		Where("chat_id NOT IN (?)", inactive).
+		Find(&groups).Error
+
+	return groups, err
+}
+
+func (d *Database) SetModeratedGroupState(chatID int64, state string) error {
+	return d.db.
+		Model(&ModeratedGroup{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			"schedule_state":    state,
+			"schedule_state_at": time.Now(),
+		}).Error
+}
+
+func (d *Database) SetModeratedGroupSnapshot(chatID int64, permissions *ChatPermissions) error {
+	return d.db.
+		Model(&ModeratedGroup{}).
+		Where("chat_id = ?", chatID).
+		Select("SnapshotPermissions").
+		Updates(&ModeratedGroup{SnapshotPermissions: permissions}).Error
+}
+
+// MigrateChatID переносит настройки группы на новый ID, когда телеграм превращает группу в супергруппу.
+// Если у нового ID уже есть настройки, они не перезаписываются
+func (d *Database) MigrateChatID(from, to int64) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		// Запись о чате и участники переносятся, даже если модерация в чате не настраивалась
+		err := tx.Model(&Chat{}).
+			Where("id = ? AND NOT EXISTS (SELECT 1 FROM chats WHERE id = ?)", from, to).
+			Updates(map[string]interface{}{"id": to, "type": "supergroup"}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&ChatMember{}).
+			Where("chat_id = ? AND user_id NOT IN (SELECT user_id FROM chat_members WHERE chat_id = ?)", from, to).
+			Update("chat_id", to).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&UserRole{}).
+			Where("chat_id = ? AND user_id NOT IN (SELECT user_id FROM user_roles WHERE chat_id = ?)", from, to).
+			Update("chat_id", to).Error
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.Model(&ModeratedGroup{}).Where("chat_id = ?", to).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		var group ModeratedGroup
+		err = tx.
+			Preload(clause.Associations).
+			Where("chat_id = ?", from).
+			First(&group).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		group.ChatID = to
+		err = createModeratedGroup(tx, &group)
+		if err != nil {
+			return err
+		}
+
+		// Предупреждения и журнал модерации не связаны с группой внешним ключом и переносятся отдельно
+		err = tx.Model(&Warning{}).Where("chat_id = ?", from).Update("chat_id", to).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&ModerationAction{}).Where("chat_id = ?", from).Update("chat_id", to).Error
+		if err != nil {
+			return err
+		}
+
+		// Дочерние записи старой группы удалятся каскадно
+		return tx.Where("chat_id = ?", from).Delete(&ModeratedGroup{}).Error
+	})
+}
+
+// SaveChat создает или обновляет запись о чате. columns - какие поля обновить у существующей записи
+func (d *Database) SaveChat(chat *Chat, columns ...string) error {
+	return d.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+		}).
+		Create(chat).Error
+}
+
+// TouchChatMember отмечает, что пользователь писал в чате. Новый участник записывается со статусом member,
+// а тот, кто числился вышедшим, снова считается участником
+func (d *Database) TouchChatMember(chatID, userID int64, at time.Time) error {
+	return d.db.
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "chat_id"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"last_seen_at": at,
+				"status": gorm.Expr("CASE WHEN chat_members.status IN (?, ?) THEN ? ELSE chat_members.status END",
+					ChatMemberLeft, ChatMemberKicked, "member"),
+			}),
+		}).
+		Create(&ChatMember{
+			ChatID:      chatID,
+			UserID:      userID,
+			Status:      "member",
+			FirstSeenAt: at,
+			LastSeenAt:  at,
+		}).Error
+}
+
+// SetChatMemberStatus сохраняет новый статус участника. Вступление и выход меняют время вступления
+// и выхода, остальные изменения статуса (например, повышение до администратора) - только сам статус
+func (d *Database) SetChatMemberStatus(chatID, userID int64, status string, at time.Time) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var member ChatMember
+		err := tx.
+			Where("chat_id = ? AND user_id = ?", chatID, userID).
+			First(&member).Error
+		isNew := errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !isNew {
+			return err
+		}
+		if isNew {
+			member = ChatMember{ChatID: chatID, UserID: userID, FirstSeenAt: at}
+		}
+
+		wasPresent := !isNew && member.IsPresent()
+		member.Status = status
+		member.LastSeenAt = at
+
+		switch {
+		case member.IsPresent() && !wasPresent:
+			member.JoinedAt = &at
+			member.LeftAt = nil
+		case !member.IsPresent() && (wasPresent || isNew):
+			member.LeftAt = &at
+		}
+
+		return tx.Save(&member).Error
+	})
+}
+
+// GetChatMember возвращает участие пользователя в группе
+func (d *Database) GetChatMember(chatID, userID int64) (*ChatMember, error) {
+	var member ChatMember
+	err := d.db.
+		Preload("Chat").
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// GetUserChats возвращает группы, в которых состоит пользователь, вместе с временем вступления
+func (d *Database) GetUserChats(userID int64) ([]ChatMember, error) {
+	var members []ChatMember
+	err := d.db.
+		Preload("Chat").
+		Where("user_id = ? AND status NOT IN ?", userID, []string{ChatMemberLeft, ChatMemberKicked}).
+		Order("joined_at DESC NULLS LAST").
+		Find(&members).Error
+
+	return members, err
+}
+
+func (d *Database) GetGlobalWhitelist() ([]GlobalWhitelistEntry, error) {
+	var entries []GlobalWhitelistEntry
+	err := d.db.
+		Order("id").
+		Find(&entries).Error
+
+	return entries, err
+}
+
+// AddGlobalWhitelistEntry добавляет запись в глобальный белый список.
+// Возвращает false, если такая запись уже есть
+func (d *Database) AddGlobalWhitelistEntry(entry *GlobalWhitelistEntry) (bool, error) {
+	result := d.db.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(entry)
+
+	return result.RowsAffected > 0, result.Error
+}
+
+func (d *Database) DeleteGlobalWhitelistEntry(id uint) error {
+	return d.db.Delete(&GlobalWhitelistEntry{}, id).Error
+}
+
+func (d *Database) ClearGlobalWhitelist() error {
+	return d.db.
+		Where("1 = 1").
+		Delete(&GlobalWhitelistEntry{}).Error
+}
+
+func (d *Database) AddWarning(warning *Warning) error {
+	return d.db.Create(warning).Error
+}
+
+// activeWarnings выбирает несгоревшие предупреждения участника
+func (d *Database) activeWarnings(chatID, userID int64, now time.Time) *gorm.DB {
+	return d.db.
+		Model(&Warning{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Where("expires_at IS NULL OR expires_at > ?", now)
+}
+
+func (d *Database) CountActiveWarnings(chatID, userID int64, now time.Time) (int64, error) {
+	var count int64
+	err := d.activeWarnings(chatID, userID, now).Count(&count).Error
+
+	return count, err
+}
+
+func (d *Database) GetActiveWarnings(chatID, userID int64, now time.Time) ([]Warning, error) {
+	var warnings []Warning
+	err := d.activeWarnings(chatID, userID, now).
+		Order("created_at").
+		Find(&warnings).Error
+
+	return warnings, err
+}
+
+// DeleteLastWarning удаляет последнее несгоревшее предупреждение участника.
+// Возвращает false, если активных предупреждений нет
+func (d *Database) DeleteLastWarning(chatID, userID int64, now time.Time) (bool, error) {
+	var warning Warning
+	err := d.activeWarnings(chatID, userID, now).
+		Order("created_at DESC").
+		First(&warning).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, d.db.Delete(&warning).Error
+}
+
+// DeleteActiveWarnings удаляет все несгоревшие предупреждения участника и возвращает их количество
+func (d *Database) DeleteActiveWarnings(chatID, userID int64, now time.Time) (int64, error) {
+	result := d.db.
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Delete(&Warning{})
+
+	return result.RowsAffected, result.Error
+}
+
+func (d *Database) AddModerationAction(action *ModerationAction) error {
+	return d.db.Create(action).Error
+}
+
+// GetModerationActions возвращает последние записи журнала модерации группы, новые первыми.
+// userID 0 - все участники, from и to - границы по времени, nil - без ограничения
+func (d *Database) GetModerationActions(chatID, userID int64, from, to *time.Time, limit int) ([]ModerationAction, error) {
+	query := d.db.Where("chat_id = ?", chatID)
+	if userID != 0 {
+		query = query.Where("target_id = ? OR actor_id = ?", userID, userID)
+	}
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+
+	var actions []ModerationAction
+	err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&actions).Error
+
+	return actions, err
+}
+
+// GetUserRoles возвращает роли пользователя во всех чатах
+func (d *Database) GetUserRoles(userID int64) ([]UserRole, error) {
+	var roles []UserRole
+	err := d.db.
+		Where("user_id = ?", userID).
+		Find(&roles).Error
+
+	return roles, err
+}
+
+// GetChatRoles возвращает роли, назначенные в чате. Владельцы и суперадминистраторы записаны с chatID 0
+func (d *Database) GetChatRoles(chatID int64) ([]UserRole, error) {
+	var roles []UserRole
+	err := d.db.
+		Where("chat_id = ?", chatID).
+		Order("created_at").
+		Find(&roles).Error
+
+	return roles, err
+}
+
+// SaveUserRole назначает роль. Прежняя роль пользователя в том же чате заменяется
+func (d *Database) SaveUserRole(role *UserRole) error {
+	return d.db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "chat_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "created_at"}),
+		}).
+		Create(role).Error
+}
+
+// DeleteUserRole снимает роль с пользователя. Возвращает false, если такой роли не было
+func (d *Database) DeleteUserRole(userID, chatID int64, role string) (bool, error) {
+	result := d.db.
+		Where("user_id = ? AND chat_id = ? AND role = ?", userID, chatID, role).
+		Delete(&UserRole{})
+
+	return result.RowsAffected > 0, result.Error
+}
@@ -5,10 +5,284 @@ import (
 )
 
 type User struct {
-	ID        int64 `gorm:"primaryKey"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           int64 `gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	FirstName    string
+	LastName     string
+	Username     string
+	LanguageCode string
+	IsBot        bool
+	IsPremium    bool
+	LastSeenAt   *time.Time // последнее обновление от пользователя, пусто - не встречался после появления учета
+}
+
+// UserNameHistory имя и юзернейм пользователя, действующие с момента ChangedAt.
+// Новая запись появляется при первой встрече пользователя и при каждой смене имени или юзернейма
+type UserNameHistory struct {
+	ID        uint  `gorm:"primaryKey"`
+	UserID    int64 `gorm:"index:idx_user_name_history"`
 	FirstName string
 	LastName  string
 	Username  string
+	ChangedAt time.Time `gorm:"index:idx_user_name_history"`
+}
+
+// Роли пользователей бота
+const (
+	RoleOwner      = "owner"      // владелец: назначает владельцев и суперадминистраторов
+	RoleSuperadmin = "superadmin" // права администратора во всех чатах и глобальный белый список
+	RoleModerator  = "moderator"  // права администратора бота в одном чате без прав администратора телеграма
+)
+
+// UserRole роль пользователя в боте. Владельцы и суперадминистраторы записываются с ChatID 0,
+// модераторы - с ID своего чата. Владельцы из конфига в таблице не хранятся
+type UserRole struct {
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	ChatID    int64 `gorm:"primaryKey;autoIncrement:false;index"`
+	Role      string
+	GrantedBy int64
+	CreatedAt time.Time
+}
+
+// Chat группа, в которой есть бот. Запись появляется при добавлении бота или по первому сообщению
+type Chat struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Title     string
+	Type      string // group или supergroup
+	Username  string
+	AddedBy   int64  // кто добавил бота, 0 - неизвестно
+	BotStatus string // статус бота в чате: member, administrator, restricted, left или kicked, пусто - неизвестен
+	Active    bool   // бот - администратор чата. Если статус бота известен, в неактивных чатах планировщик не работает
+
+	// Настройки модерации, если она включалась. Внешнего ключа нет: группы настраивались и до появления чатов
+	Group *ModeratedGroup `gorm:"foreignKey:ChatID;-:migration"`
+}
+
+// Статусы участника, который больше не состоит в чате
+const (
+	ChatMemberLeft   = "left"
+	ChatMemberKicked = "kicked"
+)
+
+// ChatMember участие пользователя в группе
+type ChatMember struct {
+	ChatID      int64  `gorm:"primaryKey;autoIncrement:false"`
+	UserID      int64  `gorm:"primaryKey;autoIncrement:false;index"`
+	Status      string // creator, administrator, member, restricted, left или kicked
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time  // последнее сообщение или изменение статуса
+	JoinedAt    *time.Time // последнее вступление, nil - неизвестно
+	LeftAt      *time.Time // последний выход, nil - не выходил после вступления
+
+	Chat *Chat `gorm:"foreignKey:ChatID;-:migration"`
+}
+
+// IsPresent проверяет, что пользователь сейчас состоит в чате
+func (m *ChatMember) IsPresent() bool {
+	return m.Status != ChatMemberLeft && m.Status != ChatMemberKicked
+}
+
+// Состояния чата, которые выставляет планировщик
+const (
+	ScheduleStateOpen   = "open"
+	ScheduleStateClosed = "closed"
+)
+
+// ModeratedGroup настройки группы, которая модерируется ботом
+type ModeratedGroup struct {
+	ChatID            int64 `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	TimeZone          string // Часовой пояс IANA, например "Europe/Moscow". Пустой - пояс из конфига
+	EveningMessage    string
+	MorningMessage    string
+	ModerateLinks     bool
+	ModerateScheduled bool
+	Disabled          bool     `gorm:"index"`           // модерация выключена командой /unmoderate
+	AllowedLinkTypes  []string `gorm:"serializer:json"` // типы ссылок, которые не удаляются
+
+	// Последнее состояние чата, примененное планировщиком. Меняется только через SetModeratedGroupState
+	ScheduleState   string // ScheduleStateOpen, ScheduleStateClosed или пусто, если еще не применялось
+	ScheduleStateAt *time.Time
+
+	// Права участников, снятые с чата перед закрытием. Меняются только через SetModeratedGroupSnapshot
+	SnapshotPermissions *ChatPermissions `gorm:"serializer:json"`
+	// Явно заданные админами права на время открытия. Если заданы, используются вместо снимка
+	OpenPermissions *ChatPermissions `gorm:"serializer:json"`
+
+	// Предупреждения: через сколько часов они сгорают (0 - не сгорают) и лестница наказаний.
+	// Лестница nil - используется лестница по умолчанию, пустая - наказаний нет
+	WarnExpireHours int
+	WarnLadder      []WarnStep `gorm:"serializer:json"`
+
+	// Антифлуд: не больше FloodLimit сообщений за FloodWindow секунд, 0 - выключен.
+	// FloodAction - "delete", SanctionMute или SanctionKick, FloodDuration - срок мута в секундах
+	FloodLimit    int
+	FloodWindow   int
+	FloodAction   string
+	FloodDuration int64
+
+	// Проверка новых участников: включена ли, сколько секунд на ответ и тип задания (button или math)
+	CaptchaEnabled bool
+	CaptchaTimeout int
+	CaptchaType    string
+
+	WhitelistedLinks []WhitelistedLink `gorm:"foreignKey:ChatID;references:ChatID;constraint:OnDelete:CASCADE"`
+	WhitelistedUsers []WhitelistedUser `gorm:"foreignKey:ChatID;references:ChatID;constraint:OnDelete:CASCADE"`
+
+	// Расписание закрытия чата
+	ScheduleWindows    []ScheduleWindow    `gorm:"foreignKey:ChatID;references:ChatID;constraint:OnDelete:CASCADE"`
+	ScheduleExceptions []ScheduleException `gorm:"foreignKey:ChatID;references:ChatID;constraint:OnDelete:CASCADE"`
+
+	// Запрещенные слова и фразы
+	Stopwords []Stopword `gorm:"foreignKey:ChatID;references:ChatID;constraint:OnDelete:CASCADE"`
+}
+
+// WhitelistedLink запись белого списка ссылок группы
+type WhitelistedLink struct {
+	ID        uint   `gorm:"primaryKey"`
+	ChatID    int64  `gorm:"uniqueIndex:idx_whitelisted_link_entry"`
+	Kind      string `gorm:"uniqueIndex:idx_whitelisted_link_entry"` // domain, prefix, username или regexp
+	Link      string `gorm:"uniqueIndex:idx_whitelisted_link_entry"`
+	CreatedAt time.Time
+}
+
+// WhitelistedUser пользователь, сообщения которого в группе не модерируются
+type WhitelistedUser struct {
+	ChatID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	UserID    int64 `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt time.Time
+}
+
+// Наказания, которые применяются к участникам
+const (
+	SanctionMute = "mute"
+	SanctionKick = "kick"
+	SanctionBan  = "ban"
+)
+
+// WarnStep ступень лестницы наказаний: при Count активных предупреждений применяется Action
+type WarnStep struct {
+	Count    int    `json:"count"`
+	Action   string `json:"action"`   // SanctionMute, SanctionKick или SanctionBan
+	Duration int64  `json:"duration"` // длительность в секундах для mute и ban, 0 - навсегда
+}
+
+// DefaultWarnExpireHours через сколько часов сгорают предупреждения в новых группах
+const DefaultWarnExpireHours = 30 * 24
+
+// DefaultWarnLadder лестница наказаний по умолчанию: 3 предупреждения - мут на час, 5 - исключение, 7 - бан
+func DefaultWarnLadder() []WarnStep {
+	return []WarnStep{
+		{Count: 3, Action: SanctionMute, Duration: 3600},
+		{Count: 5, Action: SanctionKick},
+		{Count: 7, Action: SanctionBan},
+	}
+}
+
+// Warning предупреждение участнику группы. Сгоревшие предупреждения не учитываются, но остаются в базе
+type Warning struct {
+	ID        uint  `gorm:"primaryKey"`
+	ChatID    int64 `gorm:"index:idx_warning_member"`
+	UserID    int64 `gorm:"index:idx_warning_member"`
+	ActorID   int64 // кто выдал предупреждение, 0 - автоматическая модерация
+	Reason    string
+	CreatedAt time.Time
+	ExpiresAt *time.Time // nil - не сгорает
+}
+
+// ModerationAction запись журнала модерации: что сделано с участником, кем и по какому правилу
+type ModerationAction struct {
+	ID        uint   `gorm:"primaryKey"`
+	ChatID    int64  `gorm:"index:idx_moderation_action_chat"`
+	TargetID  int64  `gorm:"index"`
+	ActorID   int64  // кто выполнил действие, 0 - бот
+	Action    string // delete, warn, unwarn, mute, unmute, kick, ban, unban или notify
+	Duration  int64  // длительность mute и ban в секундах, 0 - навсегда
+	Reason    string
+	Rule      string    // сработавшее правило: ссылка, запрещенное слово, флуд или ступень предупреждений
+	Excerpt   string    // начало текста сообщения
+	CreatedAt time.Time `gorm:"index:idx_moderation_action_chat"`
+}
+
+// Stopword запрещенное в группе слово или фраза и действие при его нахождении
+type Stopword struct {
+	ID        uint   `gorm:"primaryKey"`
+	ChatID    int64  `gorm:"uniqueIndex:idx_stopword"`
+	Kind      string `gorm:"uniqueIndex:idx_stopword"` // plain, wildcard или regexp
+	Pattern   string `gorm:"uniqueIndex:idx_stopword"`
+	Action    string // delete, warn, mute, ban или notify
+	Duration  int64  // длительность в секундах для mute и ban, 0 - навсегда
+	CreatedAt time.Time
+}
+
+// GlobalWhitelistEntry запись глобального белого списка ссылок, действует во всех группах
+type GlobalWhitelistEntry struct {
+	ID        uint   `gorm:"primaryKey"`
+	Kind      string `gorm:"uniqueIndex:idx_global_whitelist"` // domain, prefix, username или regexp
+	Pattern   string `gorm:"uniqueIndex:idx_global_whitelist"`
+	AddedBy   int64  // кто добавил запись, 0 - перенесена из старого списка
+	CreatedAt time.Time
+}
+
+// ScheduleWindow окно, в которое чат закрыт. Окно начинается в указанный день недели
+// и может переходить через полночь на следующий день (например, 22:00 - 09:00)
+type ScheduleWindow struct {
+	ID      uint   `gorm:"primaryKey"`
+	ChatID  int64  `gorm:"index"`
+	Weekday int    // 0 - воскресенье, 6 - суббота, как в time.Weekday
+	Start   string // Формат: "HH:MM"
+	End     string // Формат: "HH:MM", "24:00" - до конца суток
+}
+
+// ScheduleException разовое исключение из расписания, например праздничный день
+type ScheduleException struct {
+	ID     uint   `gorm:"primaryKey"`
+	ChatID int64  `gorm:"uniqueIndex:idx_schedule_exception"`
+	Date   string `gorm:"uniqueIndex:idx_schedule_exception"` // Формат: "YYYY-MM-DD" в часовом поясе группы
+	Closed bool   // true - чат закрыт весь день, false - открыт весь день
+	Note   string
+}
+
+// DailyScheduleWindows строит расписание, в котором чат закрывается каждый день в одно и то же время.
+// Старые настройки допускали час одной цифрой (9:00), в окнах время всегда в формате ЧЧ:ММ
+func DailyScheduleWindows(closeTime, openTime string) []ScheduleWindow {
+	if len(closeTime) == 4 {
+		closeTime = "0" + closeTime
+	}
+	if len(openTime) == 4 {
+		openTime = "0" + openTime
+	}
+
+	windows := make([]ScheduleWindow, 0, 7)
+	for weekday := 0; weekday < 7; weekday++ {
+		windows = append(windows, ScheduleWindow{
+			Weekday: weekday,
+			Start:   closeTime,
+			End:     openTime,
+		})
+	}
+
+	return windows
+}
+
+// ChatPermissions права участников чата по умолчанию, которые восстанавливаются при открытии чата
+type ChatPermissions struct {
+	CanSendMessages   bool `json:"can_send_messages"`
+	CanSendAudios     bool `json:"can_send_audios"`
+	CanSendDocuments  bool `json:"can_send_documents"`
+	CanSendPhotos     bool `json:"can_send_photos"`
+	CanSendVideos     bool `json:"can_send_videos"`
+	CanSendVideoNotes bool `json:"can_send_video_notes"`
+	CanSendVoiceNotes bool `json:"can_send_voice_notes"`
+	CanSendPolls      bool `json:"can_send_polls"`
+	CanSendOther      bool `json:"can_send_other_messages"`
+	CanAddPreviews    bool `json:"can_add_web_page_previews"`
+	CanChangeInfo     bool `json:"can_change_info"`
+	CanInviteUsers    bool `json:"can_invite_users"`
+	CanPinMessages    bool `json:"can_pin_messages"`
+	CanManageTopics   bool `json:"can_manage_topics"`
 }
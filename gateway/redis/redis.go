@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -65,6 +67,15 @@ func (r *Redis) SetWithTTL(key string, value interface{}, expiration time.Durati
 	return set.Err()
 }
 
+// SetNX записывает значение, только если ключа еще нет. Возвращает true, если запись удалась
+func (r *Redis) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	cacheKey := r.keyWithNamespace(key)
+
+	set := r.client.SetNX(context.Background(), cacheKey, value, expiration)
+
+	return set.Result()
+}
+
 func (r *Redis) GetString(key string) (string, error) {
 	cacheKey := r.keyWithNamespace(key)
 	get := r.client.Get(context.Background(), cacheKey)
@@ -99,3 +110,117 @@ func (r *Redis) Del(key string) error {
 
 	return del.Err()
 }
+
+// Keys возвращает все ключи (без неймспейса), подходящие под шаблон.
+// Использует SCAN, чтобы не блокировать редис как KEYS
+func (r *Redis) Keys(pattern string) ([]string, error) {
+	ctx := context.Background()
+	prefix := r.keyWithNamespace("")
+	var keys []string
+	var cursor uint64
+
+	for {
+		batch, next, err := r.client.Scan(ctx, cursor, r.keyWithNamespace(pattern), 100).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range batch {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+// SAdd добавляет элементы в множество и обновляет время жизни ключа
+func (r *Redis) SAdd(key string, expiration time.Duration, members ...interface{}) error {
+	cacheKey := r.keyWithNamespace(key)
+
+	pipe := r.client.TxPipeline()
+	pipe.SAdd(context.Background(), cacheKey, members...)
+	pipe.Expire(context.Background(), cacheKey, expiration)
+	_, err := pipe.Exec(context.Background())
+
+	return err
+}
+
+func (r *Redis) SMembers(key string) ([]string, error) {
+	cacheKey := r.keyWithNamespace(key)
+	members := r.client.SMembers(context.Background(), cacheKey)
+
+	return members.Result()
+}
+
+// SlidingWindowAdd добавляет событие в скользящее окно и возвращает, сколько событий в нем сейчас.
+// Окно хранится в отсортированном множестве с временем в качестве веса. Все шаги выполняются
+// одной транзакцией, поэтому счетчик остается точным, когда с редисом работают несколько реплик
+func (r *Redis) SlidingWindowAdd(key string, member string, window time.Duration) (int64, error) {
+	cacheKey := r.keyWithNamespace(key)
+	now := time.Now().UnixMilli()
+
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(context.Background(), cacheKey, "-inf", strconv.FormatInt(now-window.Milliseconds(), 10))
+	pipe.ZAdd(context.Background(), cacheKey, redis.Z{Score: float64(now), Member: member})
+	count := pipe.ZCard(context.Background(), cacheKey)
+	pipe.PExpire(context.Background(), cacheKey, window)
+	_, err := pipe.Exec(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
+
+// SlidingWindowCount возвращает, сколько событий окна попало в последний период
+func (r *Redis) SlidingWindowCount(key string, period time.Duration) (int64, error) {
+	cacheKey := r.keyWithNamespace(key)
+	from := time.Now().Add(-period).UnixMilli()
+	count := r.client.ZCount(context.Background(), cacheKey, "("+strconv.FormatInt(from, 10), "+inf")
+
+	return count.Result()
+}
+
+// SlidingWindowMembers возвращает события скользящего окна за последний период
+func (r *Redis) SlidingWindowMembers(key string, period time.Duration) ([]string, error) {
+	cacheKey := r.keyWithNamespace(key)
+	from := time.Now().Add(-period).UnixMilli()
+	members := r.client.ZRangeByScore(context.Background(), cacheKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(from, 10),
+		Max: "+inf",
+	})
+
+	return members.Result()
+}
+
+// ZAdd добавляет элемент в отсортированное множество или обновляет его вес
+func (r *Redis) ZAdd(key string, score float64, member string) error {
+	cacheKey := r.keyWithNamespace(key)
+
+	return r.client.ZAdd(context.Background(), cacheKey, redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZRangeByScore возвращает элементы отсортированного множества с весом не больше max
+func (r *Redis) ZRangeByScore(key string, max float64) ([]string, error) {
+	cacheKey := r.keyWithNamespace(key)
+	members := r.client.ZRangeByScore(context.Background(), cacheKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatFloat(max, 'f', -1, 64),
+	})
+
+	return members.Result()
+}
+
+// ZRem удаляет элемент из отсортированного множества. Возвращает true, если элемент был удален
+// именно этим вызовом, что позволяет нескольким репликам разобрать элементы без повторов
+func (r *Redis) ZRem(key string, member string) (bool, error) {
+	cacheKey := r.keyWithNamespace(key)
+	removed, err := r.client.ZRem(context.Background(), cacheKey, member).Result()
+
+	return removed > 0, err
+}
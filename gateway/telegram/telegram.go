@@ -8,8 +8,12 @@ import (
 
 func NewBot(config dto.Config) (*tele.Bot, error) {
 	pref := tele.Settings{
-		Token:   config.Bot.Token,
-		Poller:  &tele.LongPoller{Timeout: 10 * time.Second},
+		Token: config.Bot.Token,
+		Poller: &tele.LongPoller{
+			Timeout: 10 * time.Second,
+			// chat_member по умолчанию не приходит, без него не сбрасывается кеш администраторов
+			AllowedUpdates: []string{"message", "edited_message", "callback_query", "my_chat_member", "chat_member"},
+		},
 		Verbose: config.Bot.Debug,
 	}
 	b, err := tele.NewBot(pref)
@@ -17,6 +17,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata"
 )
 
 func main() {
@@ -58,6 +59,11 @@ func main() {
 		log.Fatal("Can't init telegram", zap.Error(err))
 	}
 
+	err = tg.Setup()
+	if err != nil {
+		log.Fatal("Can't setup telegram", zap.Error(err))
+	}
+
 	cronEndpoint, err := cron.NewCron(config, tg)
 	if err != nil {
 		log.Fatal("Can't init cron", zap.Error(err))
@@ -75,6 +81,17 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
+	g.Go(func() error {
+		select {
+		case sig := <-sigCh:
+			log.Info("Received signal, shutting down", zap.String("signal", sig.String()))
+			cancel()
+		case <-eCtx.Done():
+		}
+
+		return nil
+	})
+
 	g.Go(func() error {
 		log.Info("Running telegram...")
 
@@ -94,7 +111,7 @@ func main() {
 	})
 
 	if err := g.Wait(); err != nil {
-		log.Info("App terminated", zap.Error(err))
+		log.Fatal("App terminated", zap.Error(err))
 	}
 
 }
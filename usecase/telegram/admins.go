@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Сколько хранится список администраторов чата. Изменения прав приходят обновлениями chat_member
+// и сбрасывают кеш сразу, срок нужен на случай пропущенных обновлений
+const adminsTTL = 10 * time.Minute
+
+func adminsKey(chatID int64) string {
+	return fmt.Sprintf("admins:%d", chatID)
+}
+
+// chatAdmins возвращает администраторов чата из кеша, а при его отсутствии - из API телеграма
+func (t *Telegram) chatAdmins(chat *tele.Chat) ([]tele.ChatMember, error) {
+	key := adminsKey(chat.ID)
+
+	data, err := t.redis.GetBytes(key)
+	if err == nil {
+		var admins []tele.ChatMember
+		err = json.Unmarshal(data, &admins)
+		if err == nil {
+			return admins, nil
+		}
+		zap.L().Warn("Некорректный список администраторов в редисе", zap.Error(err), zap.Int64("chat_id", chat.ID))
+	}
+
+	admins, err := t.bot.AdminsOf(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(admins)
+	if err == nil {
+		err = t.redis.SetWithTTL(key, data, adminsTTL)
+	}
+	if err != nil {
+		zap.L().Error("Не удалось сохранить список администраторов", zap.Error(err), zap.Int64("chat_id", chat.ID))
+	}
+
+	return admins, nil
+}
+
+// isAdminRole проверяет, что участник - создатель или администратор чата
+func isAdminRole(member *tele.ChatMember) bool {
+	return member != nil && (member.Role == tele.Creator || member.Role == tele.Administrator)
+}
+
+// onChatMemberUpdated сохраняет новый статус участника и сбрасывает кеш администраторов,
+// когда участник становится администратором, перестает им быть или у администратора меняются права
+func (t *Telegram) onChatMemberUpdated(ctx tele.Context) error {
+	update := ctx.ChatMember()
+	if update == nil || update.Chat == nil {
+		return nil
+	}
+
+	t.recordMemberStatus(update)
+
+	if !isAdminRole(update.OldChatMember) && !isAdminRole(update.NewChatMember) {
+		return nil
+	}
+
+	err := t.redis.Del(adminsKey(update.Chat.ID))
+	if err != nil {
+		zap.L().Error("Не удалось сбросить список администраторов", zap.Error(err), zap.Int64("chat_id", update.Chat.ID))
+	}
+
+	return nil
+}
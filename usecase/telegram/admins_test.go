@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"errors"
+	"testing"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+func TestIsAdminRole(t *testing.T) {
+	tests := []struct {
+		member *tele.ChatMember
+		want   bool
+	}{
+		{member: &tele.ChatMember{Role: tele.Creator}, want: true},
+		{member: &tele.ChatMember{Role: tele.Administrator}, want: true},
+		{member: &tele.ChatMember{Role: tele.Member}, want: false},
+		{member: &tele.ChatMember{Role: tele.Restricted}, want: false},
+		{member: &tele.ChatMember{Role: tele.Left}, want: false},
+		{member: &tele.ChatMember{Role: tele.Kicked}, want: false},
+		{member: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		got := isAdminRole(tt.member)
+		if got != tt.want {
+			t.Errorf("isAdminRole(%v) = %v, want %v", tt.member, got, tt.want)
+		}
+	}
+}
+
+func TestHasRestrictRight(t *testing.T) {
+	chat := &tele.Chat{ID: -100}
+	admins := []tele.ChatMember{
+		{User: &tele.User{ID: 1}, Role: tele.Creator},
+		{User: &tele.User{ID: 2}, Role: tele.Administrator, Rights: tele.Rights{CanRestrictMembers: true}},
+		{User: &tele.User{ID: 3}, Role: tele.Administrator},
+		{Role: tele.Administrator},
+	}
+
+	tests := []struct {
+		userID    int64
+		admins    []tele.ChatMember
+		adminsErr error
+		want      bool
+		wantErr   bool
+	}{
+		{userID: 1, admins: admins, want: true},
+		{userID: 2, admins: admins, want: true},
+		{userID: 3, admins: admins, want: false},
+		{userID: 4, admins: admins, want: false},
+		{userID: 1, adminsErr: errors.New("api error"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		a := &authorizer{admins: func(*tele.Chat) ([]tele.ChatMember, error) {
+			return tt.admins, tt.adminsErr
+		}}
+
+		got, err := a.hasRestrictRight(chat, &tele.User{ID: tt.userID})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("hasRestrictRight(user %d) = %v, %v, want %v, error %v", tt.userID, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Сколько помним части альбома. Телеграм присылает их почти одновременно, запас нужен на правки подписей
+const albumTTL = 10 * time.Minute
+
+func albumKey(chatID int64, albumID string) string {
+	return fmt.Sprintf("album:%d:%s", chatID, albumID)
+}
+
+func albumDeletedKey(chatID int64, albumID string) string {
+	return fmt.Sprintf("album_deleted:%d:%s", chatID, albumID)
+}
+
+func albumWarnedKey(chatID int64, albumID string) string {
+	return fmt.Sprintf("album_warned:%d:%s", chatID, albumID)
+}
+
+// trackAlbum запоминает сообщение как часть альбома. Если альбом уже удален модерацией,
+// сообщение удаляется сразу и возвращается true
+func (t *Telegram) trackAlbum(msg *tele.Message) bool {
+	if msg.AlbumID == "" {
+		return false
+	}
+
+	err := t.redis.SAdd(albumKey(msg.Chat.ID, msg.AlbumID), albumTTL, msg.ID)
+	if err != nil {
+		zap.L().Error("Не удалось запомнить часть альбома", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	if !t.redis.Has(albumDeletedKey(msg.Chat.ID, msg.AlbumID)) {
+		return false
+	}
+
+	err = t.bot.Delete(msg)
+	if err != nil {
+		zap.L().Error("Не удалось удалить часть альбома", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	return true
+}
+
+// deleteMessage удаляет сообщение, а если оно часть альбома - весь альбом.
+// Части альбома, которые придут позже, удалит trackAlbum
+func (t *Telegram) deleteMessage(msg *tele.Message) error {
+	if msg.AlbumID == "" {
+		return t.reportRightsError(msg.Chat.ID, rightsProblemDelete, t.bot.Delete(msg))
+	}
+
+	err := t.redis.SetWithTTL(albumDeletedKey(msg.Chat.ID, msg.AlbumID), "1", albumTTL)
+	if err != nil {
+		zap.L().Error("Не удалось отметить альбом удаленным", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	ids, err := t.redis.SMembers(albumKey(msg.Chat.ID, msg.AlbumID))
+	if err != nil {
+		zap.L().Error("Не удалось получить части альбома", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	messages := []tele.Editable{msg}
+	current := strconv.Itoa(msg.ID)
+	for _, id := range ids {
+		if id == current {
+			continue
+		}
+		messages = append(messages, tele.StoredMessage{MessageID: id, ChatID: msg.Chat.ID})
+	}
+
+	return t.reportRightsError(msg.Chat.ID, rightsProblemDelete, t.bot.DeleteMany(messages))
+}
+
+// firstAlbumViolation возвращает true только для первого нарушения в альбоме, чтобы за один альбом,
+// части которого проверяются параллельно, выдавалось одно предупреждение
+func (t *Telegram) firstAlbumViolation(msg *tele.Message) bool {
+	if msg.AlbumID == "" {
+		return true
+	}
+
+	first, err := t.redis.SetNX(albumWarnedKey(msg.Chat.ID, msg.AlbumID), "1", albumTTL)
+	if err != nil {
+		zap.L().Error("Не удалось отметить нарушение в альбоме", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+		return true
+	}
+
+	return first
+}
@@ -0,0 +1,257 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Действия журнала модерации, кроме наказаний mute, kick и ban
+const (
+	actionDelete = "delete" // удаление сообщения
+	actionWarn   = "warn"   // предупреждение
+	actionUnwarn = "unwarn" // снятие предупреждений
+	actionUnmute = "unmute" // снятие ограничений
+	actionUnban  = "unban"  // снятие бана
+	actionNotify = "notify" // сообщение администраторам без удаления
+)
+
+// Названия действий журнала модерации
+var actionNames = map[string]string{
+	actionDelete:          "удаление сообщения",
+	actionWarn:            "предупреждение",
+	actionUnwarn:          "снятие предупреждений",
+	actionUnmute:          "снятие ограничений",
+	actionUnban:           "разбан",
+	actionNotify:          "уведомление администраторов",
+	database.SanctionMute: "мут",
+	database.SanctionKick: "исключение",
+	database.SanctionBan:  "бан",
+}
+
+const (
+	listModlog        = "modlog"
+	modlogLimit       = 500 // сколько последних записей показывает /modlog
+	excerptLength     = 200 // сколько символов сообщения сохраняется в журнале
+	modlogFieldLength = 60  // сколько символов правила, причины и сообщения показывает /modlog
+	modlogDateLayout  = "2006-01-02"
+	modlogEntryLayout = "2006-01-02 15:04"
+)
+
+const modlogHelp = "Использование: /modlog [пользователь] [с ГГГГ-ММ-ДД [по ГГГГ-ММ-ДД]]\n" +
+	"Пользователь указывается ответом на сообщение, @username или ID. Одна дата - записи за этот день"
+
+// setupAudit регистрирует команду журнала модерации
+func (t *Telegram) setupAudit() {
+	t.bot.Handle("/modlog", t.cmdModlog)
+
+	t.registerList(listModlog, t.modlogList)
+}
+
+// logAction записывает действие в журнал модерации. Ошибка записи не мешает самой модерации
+func (t *Telegram) logAction(action *database.ModerationAction) {
+	err := t.db.AddModerationAction(action)
+	if err != nil {
+		zap.L().Error("Не удалось записать действие в журнал модерации",
+			zap.Error(err),
+			zap.Int64("chat_id", action.ChatID),
+			zap.String("action", action.Action))
+	}
+}
+
+// messageExcerpt возвращает начало текста или подписи сообщения для журнала
+func messageExcerpt(msg *tele.Message) string {
+	if msg == nil {
+		return ""
+	}
+
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+
+	return truncateText(text, excerptLength)
+}
+
+// truncateText обрезает текст до указанного количества символов
+func truncateText(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+
+	return string([]rune(text)[:length]) + "…"
+}
+
+// knownUsers достает из базы пользователей с указанными ID. Незнакомые боту пользователи
+// возвращаются только с ID
+func (t *Telegram) knownUsers(ids []int64) map[int64]*tele.User {
+	users := make(map[int64]*tele.User, len(ids))
+	for _, id := range ids {
+		users[id] = &tele.User{ID: id}
+	}
+	if len(ids) == 0 {
+		return users
+	}
+
+	found, err := t.db.GetUsersByIDs(ids)
+	if err != nil {
+		zap.L().Error("Не удалось получить пользователей", zap.Error(err))
+	}
+	for _, user := range found {
+		users[user.ID] = &tele.User{
+			ID:        user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Username:  user.Username,
+		}
+	}
+
+	return users
+}
+
+// cmdModlog показывает журнал модерации группы с фильтром по участнику и датам
+func (t *Telegram) cmdModlog(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	userID := "0"
+	if repliedMessage(ctx.Message()) != nil || (len(args) > 0 && !isModlogDate(args[0])) {
+		user, rest, err := t.resolveTarget(ctx)
+		if err != nil {
+			return ctx.Reply(err.Error())
+		}
+		userID, args = strconv.FormatInt(user.ID, 10), rest
+	}
+
+	if len(args) > 2 {
+		return ctx.Reply(modlogHelp)
+	}
+	for _, arg := range args {
+		if !isModlogDate(arg) {
+			return ctx.Reply("Некорректная дата.\n\n" + modlogHelp)
+		}
+	}
+
+	// Параметры списка: участник и даты. Пустая дата - без ограничения
+	params := []string{userID, "", ""}
+	copy(params[1:], args)
+
+	return t.sendList(ctx, listModlog, params...)
+}
+
+// isModlogDate проверяет, что аргумент - дата в формате ГГГГ-ММ-ДД
+func isModlogDate(value string) bool {
+	_, err := time.Parse(modlogDateLayout, value)
+	return err == nil
+}
+
+// modlogList собирает записи журнала модерации для вывода по страницам.
+// Даты считаются в часовом поясе группы, конечная дата входит в период
+func (t *Telegram) modlogList(ctx tele.Context, params []string) (string, []string, error) {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(params) != 3 {
+		return "", nil, errors.New(modlogHelp)
+	}
+
+	userID, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		return "", nil, errors.New(modlogHelp)
+	}
+
+	loc := t.groupLocation(group)
+	var from, to *time.Time
+	if params[1] != "" {
+		start, err := time.ParseInLocation(modlogDateLayout, params[1], loc)
+		if err != nil {
+			return "", nil, errors.New(modlogHelp)
+		}
+		end := start.AddDate(0, 0, 1)
+		if params[2] != "" {
+			last, err := time.ParseInLocation(modlogDateLayout, params[2], loc)
+			if err != nil {
+				return "", nil, errors.New(modlogHelp)
+			}
+			end = last.AddDate(0, 0, 1)
+		}
+		from, to = &start, &end
+	}
+
+	actions, err := t.db.GetModerationActions(group.ChatID, userID, from, to, modlogLimit)
+	if err != nil {
+		zap.L().Error("Не удалось получить журнал модерации", zap.Error(err))
+		return "", nil, errors.New("Ошибка при получении журнала модерации")
+	}
+
+	ids := make([]int64, 0, len(actions)*2)
+	for _, action := range actions {
+		ids = append(ids, action.TargetID)
+		if action.ActorID != 0 {
+			ids = append(ids, action.ActorID)
+		}
+	}
+	users := t.knownUsers(ids)
+
+	items := make([]string, 0, len(actions))
+	for _, action := range actions {
+		items = append(items, formatModerationAction(action, users, loc))
+	}
+
+	title := "Журнал модерации, новые записи первыми"
+	if userID != 0 {
+		title += "\nУчастник: " + formatUser(t.knownUsers([]int64{userID})[userID])
+	}
+	if from != nil {
+		title += fmt.Sprintf("\nПериод: %s - %s", from.Format(modlogDateLayout), to.AddDate(0, 0, -1).Format(modlogDateLayout))
+	}
+
+	return title, items, nil
+}
+
+// formatModerationAction выводит запись журнала модерации одной строкой
+func formatModerationAction(action database.ModerationAction, users map[int64]*tele.User, loc *time.Location) string {
+	name := actionNames[action.Action]
+	switch {
+	case action.Action == database.SanctionMute || action.Action == database.SanctionBan:
+		name = formatSanction(action.Action, time.Duration(action.Duration)*time.Second)
+	case name == "":
+		name = action.Action
+	}
+
+	actor := "бот"
+	if action.ActorID != 0 {
+		actor = formatUser(users[action.ActorID])
+	}
+
+	parts := []string{
+		action.CreatedAt.In(loc).Format(modlogEntryLayout),
+		name,
+		formatUser(users[action.TargetID]),
+		actor,
+	}
+	// Длинные поля обрезаются, чтобы страница из 20 записей поместилась в одно сообщение
+	if action.Rule != "" {
+		parts = append(parts, "правило: "+truncateText(action.Rule, modlogFieldLength))
+	}
+	if action.Reason != "" {
+		parts = append(parts, "причина: "+truncateText(action.Reason, modlogFieldLength))
+	}
+	if action.Excerpt != "" {
+		excerpt := strings.ReplaceAll(action.Excerpt, "\n", " ")
+		parts = append(parts, fmt.Sprintf("«%s»", truncateText(excerpt, modlogFieldLength)))
+	}
+
+	return strings.Join(parts, " | ")
+}
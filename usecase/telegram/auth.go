@@ -0,0 +1,240 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"app/gateway/redis"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Сколько хранятся роли пользователя в кеше. Назначение и снятие роли сбрасывают кеш сразу
+// на всех копиях бота, срок нужен на случай изменений напрямую в базе
+const rolesTTL = 10 * time.Minute
+
+func rolesKey(userID int64) string {
+	return fmt.Sprintf("roles:%d", userID)
+}
+
+// authorizer единая проверка прав в боте. Учитывает владельцев из конфига, роли из базы
+// и администраторов чатов в телеграме. Роли читаются при каждом сообщении,
+// поэтому кешируются в редисе по пользователю, в том числе пустой список
+type authorizer struct {
+	db     *database.Database
+	redis  *redis.Redis
+	admins func(chat *tele.Chat) ([]tele.ChatMember, error) // администраторы чата в телеграме
+	owners map[int64]bool                                   // владельцы из конфига
+}
+
+func newAuthorizer(owners []int64, db *database.Database, redis *redis.Redis, admins func(chat *tele.Chat) ([]tele.ChatMember, error)) *authorizer {
+	a := &authorizer{
+		db:     db,
+		redis:  redis,
+		admins: admins,
+		owners: make(map[int64]bool, len(owners)),
+	}
+	for _, id := range owners {
+		a.owners[id] = true
+	}
+
+	return a
+}
+
+// userRoles возвращает роли пользователя из кеша, а при его отсутствии - из базы
+func (a *authorizer) userRoles(userID int64) ([]database.UserRole, error) {
+	key := rolesKey(userID)
+
+	data, err := a.redis.GetBytes(key)
+	if err == nil {
+		var roles []database.UserRole
+		err = json.Unmarshal(data, &roles)
+		if err == nil {
+			return roles, nil
+		}
+		zap.L().Warn("Некорректный список ролей в редисе", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	roles, err := a.db.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(roles)
+	if err == nil {
+		err = a.redis.SetWithTTL(key, data, rolesTTL)
+	}
+	if err != nil {
+		zap.L().Error("Не удалось сохранить роли в редис", zap.Error(err), zap.Int64("user_id", userID))
+	}
+
+	return roles, nil
+}
+
+// hasRole проверяет роль пользователя в чате. Для владельцев и суперадминистраторов chatID равен 0.
+// Если роли получить не удалось, роли нет
+func (a *authorizer) hasRole(userID, chatID int64, role string) bool {
+	roles, err := a.userRoles(userID)
+	if err != nil {
+		zap.L().Error("Не удалось получить роли пользователя", zap.Error(err), zap.Int64("user_id", userID))
+		return false
+	}
+
+	for _, r := range roles {
+		if r.ChatID == chatID && r.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invalidate сбрасывает кеш ролей пользователя
+func (a *authorizer) invalidate(userID int64) {
+	err := a.redis.Del(rolesKey(userID))
+	if err != nil {
+		zap.L().Error("Не удалось сбросить кеш ролей", zap.Error(err), zap.Int64("user_id", userID))
+	}
+}
+
+// invalidateChat сбрасывает кеш ролей всех модераторов чата, например после его переноса
+func (a *authorizer) invalidateChat(chatID int64) error {
+	roles, err := a.db.GetChatRoles(chatID)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		a.invalidate(role.UserID)
+	}
+
+	return nil
+}
+
+// isConfigOwner проверяет, что пользователь указан владельцем в конфиге
+func (a *authorizer) isConfigOwner(userID int64) bool {
+	return a.owners[userID]
+}
+
+// isOwner проверяет, что пользователь - владелец бота из конфига или из базы
+func (a *authorizer) isOwner(userID int64) bool {
+	return a.isConfigOwner(userID) || a.hasRole(userID, 0, database.RoleOwner)
+}
+
+// isSuperadmin проверяет, что у пользователя есть права во всех чатах: он владелец или суперадминистратор
+func (a *authorizer) isSuperadmin(userID int64) bool {
+	return a.isOwner(userID) || a.hasRole(userID, 0, database.RoleSuperadmin)
+}
+
+// isModerator проверяет, что пользователь назначен модератором чата
+func (a *authorizer) isModerator(chatID, userID int64) bool {
+	return a.hasRole(userID, chatID, database.RoleModerator)
+}
+
+// chatRoles возвращает роли, назначенные в чате. Для владельцев и суперадминистраторов chatID равен 0
+func (a *authorizer) chatRoles(chatID int64) ([]database.UserRole, error) {
+	return a.db.GetChatRoles(chatID)
+}
+
+// adminMember возвращает пользователя из списка администраторов чата в телеграме, nil - не администратор
+func (a *authorizer) adminMember(chat *tele.Chat, user *tele.User) (*tele.ChatMember, error) {
+	admins, err := a.admins(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range admins {
+		if admins[i].User != nil && admins[i].User.ID == user.ID {
+			return &admins[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// checkAdmin проверяет, есть ли у пользователя права администратора бота в чате: он администратор
+// в телеграме, модератор чата или суперадминистратор. Ошибка означает, что список администраторов
+// получить не удалось и ответ неизвестен
+func (a *authorizer) checkAdmin(chat *tele.Chat, user *tele.User) (bool, error) {
+	if a.isSuperadmin(user.ID) || a.isModerator(chat.ID, user.ID) {
+		return true, nil
+	}
+
+	member, err := a.adminMember(chat, user)
+	if err != nil {
+		return false, err
+	}
+
+	return member != nil, nil
+}
+
+// isAdmin проверяет права на команды. Если список администраторов недоступен, прав нет
+func (a *authorizer) isAdmin(chat *tele.Chat, user *tele.User) bool {
+	admin, err := a.checkAdmin(chat, user)
+	if err != nil {
+		zap.L().Error("Не удалось получить список администраторов", zap.Error(err), zap.Int64("chat_id", chat.ID))
+		return false
+	}
+
+	return admin
+}
+
+// hasRestrictRight проверяет право блокировки в самом телеграме: создатель чата
+// или администратор с правом блокировки. Так проверяются и права бота
+func (a *authorizer) hasRestrictRight(chat *tele.Chat, user *tele.User) (bool, error) {
+	member, err := a.adminMember(chat, user)
+	if err != nil || member == nil {
+		return false, err
+	}
+
+	return member.Role == tele.Creator || member.CanRestrictMembers, nil
+}
+
+// canRestrict проверяет, может ли пользователь наказывать участников командами бота.
+// Роль модератора права блокировки не дает, нужны права в самом телеграме
+func (a *authorizer) canRestrict(chat *tele.Chat, user *tele.User) (bool, error) {
+	if a.isSuperadmin(user.ID) {
+		return true, nil
+	}
+
+	return a.hasRestrictRight(chat, user)
+}
+
+// canManageModerators проверяет, может ли пользователь назначать модераторов чата: создатель чата
+// или администратор с правом назначать администраторов. Сами модераторы назначать других не могут
+func (a *authorizer) canManageModerators(chat *tele.Chat, user *tele.User) (bool, error) {
+	if a.isSuperadmin(user.ID) {
+		return true, nil
+	}
+
+	member, err := a.adminMember(chat, user)
+	if err != nil || member == nil {
+		return false, err
+	}
+
+	return member.Role == tele.Creator || member.CanPromoteMembers, nil
+}
+
+// grant назначает роль и сбрасывает кеш ролей пользователя
+func (a *authorizer) grant(role *database.UserRole) error {
+	err := a.db.SaveUserRole(role)
+	if err != nil {
+		return err
+	}
+	a.invalidate(role.UserID)
+
+	return nil
+}
+
+// revoke снимает роль и сбрасывает кеш ролей пользователя. Возвращает false, если такой роли не было
+func (a *authorizer) revoke(userID, chatID int64, role string) (bool, error) {
+	deleted, err := a.db.DeleteUserRole(userID, chatID, role)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	a.invalidate(userID)
+
+	return true, nil
+}
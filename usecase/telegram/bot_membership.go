@@ -0,0 +1,107 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Сообщение в группе сразу после добавления бота
+const onboardingMessage = "Привет! Я помогаю модерировать чат: закрываю его на ночь по расписанию, " +
+	"удаляю ссылки, спам и флуд, выдаю предупреждения и проверяю новых участников.\n\n" +
+	"Чтобы начать, сделайте меня администратором с правами удалять сообщения и блокировать участников, " +
+	"затем администратор группы отправляет /moderate."
+
+// Инструкция в личку тому, кто добавил бота
+const setupInstructions = "Спасибо, что добавили меня в чат %s. Как включить модерацию:\n\n" +
+	"1. Сделайте бота администратором с правами удалять сообщения и блокировать участников\n" +
+	"2. Отправьте в группе /moderate - включатся настройки по умолчанию и появится список команд\n" +
+	"3. Проверьте права бота и расписание командой /diagnose\n\n" +
+	"По умолчанию чат закрывается с 22:00 до 09:00, изменить расписание можно командой /schedule."
+
+// isPresentRole проверяет, что участник находится в чате
+func isPresentRole(member *tele.ChatMember) bool {
+	if member == nil {
+		return false
+	}
+
+	switch member.Role {
+	case tele.Creator, tele.Administrator, tele.Member:
+		return true
+	case tele.Restricted:
+		return member.Member
+	}
+
+	return false
+}
+
+// onMyChatMember обрабатывает изменение статуса самого бота в чате: добавление, удаление,
+// повышение до администратора и снятие прав
+func (t *Telegram) onMyChatMember(ctx tele.Context) error {
+	// Права бота входят в кешированный список администраторов
+	err := t.onChatMemberUpdated(ctx)
+	if err != nil {
+		return err
+	}
+
+	update := ctx.ChatMember()
+	if update == nil || update.NewChatMember == nil || !isGroupChat(update.Chat) {
+		return nil
+	}
+
+	chat := &database.Chat{
+		ID:        update.Chat.ID,
+		Title:     update.Chat.Title,
+		Type:      string(update.Chat.Type),
+		Username:  update.Chat.Username,
+		BotStatus: string(update.NewChatMember.Role),
+		Active:    update.NewChatMember.Role == tele.Administrator,
+	}
+	logger := zap.L().With(zap.Int64("chat_id", chat.ID), zap.String("status", chat.BotStatus))
+
+	if !isPresentRole(update.OldChatMember) && isPresentRole(update.NewChatMember) {
+		if update.Sender != nil {
+			chat.AddedBy = update.Sender.ID
+		}
+
+		err = t.db.SaveChat(chat, "title", "type", "username", "added_by", "bot_status", "active")
+		if err != nil {
+			logger.Error("Не удалось сохранить чат", zap.Error(err))
+		}
+		logger.Info("Бот добавлен в чат", zap.Int64("added_by", chat.AddedBy))
+
+		t.sendOnboarding(update)
+		return nil
+	}
+
+	err = t.db.SaveChat(chat, "title", "type", "username", "bot_status", "active")
+	if err != nil {
+		logger.Error("Не удалось обновить статус бота в чате", zap.Error(err))
+	}
+
+	if !chat.Active {
+		logger.Info("Бот удален из чата или лишен прав администратора, планировщик пропускает чат")
+	}
+
+	return nil
+}
+
+// sendOnboarding пишет в группу, что умеет бот, а добавившему его - как включить модерацию.
+// Личное сообщение дойдет, только если пользователь уже начинал диалог с ботом
+func (t *Telegram) sendOnboarding(update *tele.ChatMemberUpdate) {
+	_, err := t.bot.Send(update.Chat, onboardingMessage)
+	if err != nil {
+		zap.L().Warn("Не удалось отправить приветствие в группу", zap.Error(err), zap.Int64("chat_id", update.Chat.ID))
+	}
+
+	if update.Sender == nil || update.Sender.IsBot {
+		return
+	}
+
+	_, err = t.bot.Send(update.Sender, fmt.Sprintf(setupInstructions, update.Chat.Title))
+	if err != nil {
+		zap.L().Debug("Не удалось отправить инструкцию добавившему бота", zap.Error(err), zap.Int64("user_id", update.Sender.ID))
+	}
+}
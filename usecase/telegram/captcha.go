@@ -0,0 +1,420 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"encoding/json"
+	"fmt"
+	"html"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Типы заданий для новых участников
+const (
+	captchaButton = "button" // нажать кнопку
+	captchaMath   = "math"   // выбрать ответ на пример
+)
+
+// Отсортированное множество непройденных проверок со сроком в качестве веса
+const captchaDeadlinesKey = "captcha:deadlines"
+
+// Кнопка ответа на проверку. В данных кнопки передаются ID участника и выбранный ответ
+var captchaButtonBtn = &tele.Btn{Unique: "captcha"}
+
+// captchaChallenge проверка, которую проходит новый участник
+type captchaChallenge struct {
+	ChatID             int64  `json:"chat_id"`
+	UserID             int64  `json:"user_id"`
+	Answer             string `json:"answer"`
+	ChallengeMessageID int    `json:"challenge_message_id"`
+	JoinMessageID      int    `json:"join_message_id"`
+
+	// Ограничения, которые были у участника до входа, например мут до выхода из чата.
+	// После проверки они возвращаются вместо снятия всех ограничений
+	PreviousRights *tele.Rights `json:"previous_rights,omitempty"`
+	PreviousUntil  int64        `json:"previous_until,omitempty"`
+}
+
+func captchaKey(chatID, userID int64) string {
+	return fmt.Sprintf("captcha:%d:%d", chatID, userID)
+}
+
+func captchaMember(chatID, userID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+func captchaJoinKey(chatID int64, messageID int, userID int64) string {
+	return fmt.Sprintf("captcha_join:%d:%d:%d", chatID, messageID, userID)
+}
+
+// Сколько помнится, что по сообщению о входе проверка уже запущена
+const captchaJoinTTL = 10 * time.Minute
+
+// onUserJoined запускает проверку для каждого нового участника. Ботов и тех,
+// кого добавил администратор, не проверяем. Телебот вызывает обработчик по одному разу на участника,
+// если телеграм не прислал устаревшее поле new_chat_member, и один раз, если прислал. Поэтому
+// перебираются все участники из сообщения, а повторный запуск для того же участника пропускается
+func (t *Telegram) onUserJoined(ctx tele.Context) error {
+	msg := ctx.Message()
+	if msg == nil || !isGroupChat(msg.Chat) {
+		return nil
+	}
+
+	group, err := t.cachedModeratedGroup(msg.Chat.ID)
+	if err != nil || group.Disabled || !group.CaptchaEnabled {
+		return nil
+	}
+
+	users := msg.UsersJoined
+	if len(users) == 0 && msg.UserJoined != nil {
+		users = []tele.User{*msg.UserJoined}
+	}
+
+	for i := range users {
+		user := &users[i]
+		if user.IsBot {
+			continue
+		}
+		if msg.Sender != nil && msg.Sender.ID != user.ID && t.auth.isAdmin(msg.Chat, msg.Sender) {
+			continue
+		}
+
+		first, err := t.redis.SetNX(captchaJoinKey(msg.Chat.ID, msg.ID, user.ID), "1", captchaJoinTTL)
+		if err != nil {
+			zap.L().Error("Не удалось отметить проверку участника", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+			continue
+		}
+		if !first {
+			continue
+		}
+
+		t.startCaptcha(group, msg, user)
+	}
+
+	return nil
+}
+
+// startCaptcha ограничивает участника и отправляет ему задание
+func (t *Telegram) startCaptcha(group *database.ModeratedGroup, msg *tele.Message, user *tele.User) {
+	logger := zap.L().With(zap.Int64("chat_id", msg.Chat.ID), zap.Int64("user_id", user.ID))
+
+	// Ограничения, выданные раньше, сохраняются: иначе замученный участник снял бы мут,
+	// выйдя из чата и пройдя проверку заново
+	var previousRights *tele.Rights
+	var previousUntil int64
+	member, err := t.bot.ChatMemberOf(msg.Chat, user)
+	if err != nil {
+		logger.Warn("Не удалось получить статус нового участника", zap.Error(err))
+	} else if member.Role == tele.Restricted {
+		previousRights, previousUntil = &member.Rights, member.RestrictedUntil
+	}
+
+	err = t.applySanction(msg.Chat, user, database.SanctionMute, 0)
+	if err != nil {
+		logger.Error("Не удалось ограничить нового участника", zap.Error(err))
+		return
+	}
+	t.logAction(&database.ModerationAction{
+		ChatID:   msg.Chat.ID,
+		TargetID: user.ID,
+		Action:   database.SanctionMute,
+		Reason:   "до прохождения проверки",
+		Rule:     "проверка новых участников",
+	})
+
+	timeout := group.CaptchaTimeout
+	if timeout <= 0 {
+		timeout = 120
+	}
+
+	name := html.EscapeString(strings.TrimSpace(user.FirstName + " " + user.LastName))
+	if name == "" {
+		name = "Участник"
+	}
+	mention := fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, user.ID, name)
+
+	userID := strconv.FormatInt(user.ID, 10)
+	markup := &tele.ReplyMarkup{}
+	var text, answer string
+
+	switch group.CaptchaType {
+	case captchaMath:
+		a, b := rand.Intn(9)+1, rand.Intn(9)+1
+		answer = strconv.Itoa(a + b)
+		text = fmt.Sprintf("%s, добро пожаловать! Чтобы писать в чат, выберите ответ за %d сек.: %d + %d = ?", mention, timeout, a, b)
+
+		var row tele.Row
+		for _, option := range captchaOptions(a + b) {
+			row = append(row, markup.Data(strconv.Itoa(option), captchaButtonBtn.Unique, userID, strconv.Itoa(option)))
+		}
+		markup.Inline(row)
+	default:
+		answer = "ok"
+		text = fmt.Sprintf("%s, добро пожаловать! Чтобы писать в чат, нажмите кнопку за %d сек.", mention, timeout)
+		markup.Inline(markup.Row(markup.Data("Я не бот", captchaButtonBtn.Unique, userID, answer)))
+	}
+
+	sent, err := t.bot.Send(msg.Chat, text, markup, tele.ModeHTML)
+	if err != nil {
+		logger.Error("Не удалось отправить проверку", zap.Error(err))
+
+		// Без задания участник не сможет пройти проверку, поэтому мут снимается
+		err = t.restoreRights(msg.Chat, user, previousRights, previousUntil)
+		if err != nil {
+			logger.Error("Не удалось вернуть права участнику", zap.Error(err))
+			return
+		}
+		t.logAction(&database.ModerationAction{
+			ChatID:   msg.Chat.ID,
+			TargetID: user.ID,
+			Action:   actionUnmute,
+			Reason:   "не удалось отправить проверку",
+			Rule:     "проверка новых участников",
+		})
+		return
+	}
+
+	data, err := json.Marshal(captchaChallenge{
+		ChatID:             msg.Chat.ID,
+		UserID:             user.ID,
+		Answer:             answer,
+		ChallengeMessageID: sent.ID,
+		JoinMessageID:      msg.ID,
+		PreviousRights:     previousRights,
+		PreviousUntil:      previousUntil,
+	})
+	if err != nil {
+		logger.Error("Не удалось сохранить проверку", zap.Error(err))
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	err = t.redis.SetWithTTL(captchaKey(msg.Chat.ID, user.ID), string(data), time.Duration(timeout)*time.Second+time.Hour)
+	if err == nil {
+		err = t.redis.ZAdd(captchaDeadlinesKey, float64(deadline.Unix()), captchaMember(msg.Chat.ID, user.ID))
+	}
+	if err != nil {
+		logger.Error("Не удалось сохранить проверку", zap.Error(err))
+	}
+}
+
+// captchaOptions возвращает правильный ответ и три неправильных в случайном порядке
+func captchaOptions(answer int) []int {
+	options := []int{answer}
+	for len(options) < 4 {
+		option := rand.Intn(17) + 2
+		duplicate := false
+		for _, existing := range options {
+			if existing == option {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			options = append(options, option)
+		}
+	}
+
+	rand.Shuffle(len(options), func(i, j int) {
+		options[i], options[j] = options[j], options[i]
+	})
+
+	return options
+}
+
+// onCaptchaAnswer обрабатывает ответ на проверку. Неверный ответ означает исключение из чата
+func (t *Telegram) onCaptchaAnswer(ctx tele.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 || ctx.Chat() == nil {
+		return ctx.Respond()
+	}
+
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return ctx.Respond()
+	}
+	if ctx.Sender().ID != userID {
+		return ctx.Respond(&tele.CallbackResponse{Text: "Это задание для другого участника", ShowAlert: true})
+	}
+
+	// Проверку забирает тот, кто первым убрал ее из списка сроков: ответ или истечение времени
+	claimed, err := t.redis.ZRem(captchaDeadlinesKey, captchaMember(ctx.Chat().ID, userID))
+	if err != nil {
+		zap.L().Error("Не удалось обработать ответ на проверку", zap.Error(err))
+		return ctx.Respond()
+	}
+	challenge, ok := t.loadCaptcha(ctx.Chat().ID, userID)
+	if !claimed || !ok {
+		return ctx.Respond(&tele.CallbackResponse{Text: "Время на ответ истекло", ShowAlert: true})
+	}
+
+	if args[1] != challenge.Answer {
+		t.failCaptcha(challenge, "неверный ответ")
+		return ctx.Respond(&tele.CallbackResponse{Text: "Неверный ответ", ShowAlert: true})
+	}
+
+	err = t.restoreRights(ctx.Chat(), ctx.Sender(), challenge.PreviousRights, challenge.PreviousUntil)
+	if err != nil {
+		zap.L().Error("Не удалось вернуть права участнику", zap.Error(err), zap.Int64("chat_id", ctx.Chat().ID))
+	}
+	t.cleanupCaptcha(challenge)
+
+	return ctx.Respond(&tele.CallbackResponse{Text: "Спасибо! Теперь вы можете писать в чат"})
+}
+
+// restoreRights возвращает участнику права, которые были до проверки: прежние ограничения,
+// если их срок не истек, или права чата без личных ограничений
+func (t *Telegram) restoreRights(chat *tele.Chat, user *tele.User, rights *tele.Rights, until int64) error {
+	if rights == nil || (until > 0 && until <= time.Now().Unix()) {
+		return t.liftRestrictions(chat, user)
+	}
+
+	previous := *rights
+	previous.Independent = true
+
+	return t.bot.Restrict(chat, &tele.ChatMember{User: user, Rights: previous, RestrictedUntil: until})
+}
+
+// expireCaptchas исключает участников, не прошедших проверку вовремя
+func (t *Telegram) expireCaptchas() {
+	members, err := t.redis.ZRangeByScore(captchaDeadlinesKey, float64(time.Now().Unix()))
+	if err != nil {
+		zap.L().Error("Не удалось получить просроченные проверки", zap.Error(err))
+		return
+	}
+
+	for _, member := range members {
+		claimed, err := t.redis.ZRem(captchaDeadlinesKey, member)
+		if err != nil || !claimed {
+			continue
+		}
+
+		var chatID, userID int64
+		_, err = fmt.Sscanf(member, "%d:%d", &chatID, &userID)
+		if err != nil {
+			continue
+		}
+
+		challenge, ok := t.loadCaptcha(chatID, userID)
+		if !ok {
+			continue
+		}
+		t.failCaptcha(challenge, "время на ответ истекло")
+	}
+}
+
+// loadCaptcha читает проверку участника из редиса
+func (t *Telegram) loadCaptcha(chatID, userID int64) (*captchaChallenge, bool) {
+	data, err := t.redis.GetBytes(captchaKey(chatID, userID))
+	if err != nil {
+		return nil, false
+	}
+
+	var challenge captchaChallenge
+	err = json.Unmarshal(data, &challenge)
+	if err != nil {
+		zap.L().Error("Некорректная проверка в редисе", zap.Error(err), zap.Int64("chat_id", chatID))
+		return nil, false
+	}
+
+	return &challenge, true
+}
+
+// failCaptcha исключает участника, не прошедшего проверку. Вернуться он может по ссылке
+func (t *Telegram) failCaptcha(challenge *captchaChallenge, reason string) {
+	chat := &tele.Chat{ID: challenge.ChatID}
+	err := t.applySanction(chat, &tele.User{ID: challenge.UserID}, database.SanctionKick, 0)
+	if err != nil {
+		zap.L().Error("Не удалось исключить участника без проверки", zap.Error(err), zap.Int64("chat_id", challenge.ChatID))
+	} else {
+		t.logAction(&database.ModerationAction{
+			ChatID:   challenge.ChatID,
+			TargetID: challenge.UserID,
+			Action:   database.SanctionKick,
+			Reason:   reason,
+			Rule:     "проверка новых участников",
+		})
+	}
+
+	t.cleanupCaptcha(challenge)
+}
+
+// cleanupCaptcha удаляет задание, служебное сообщение о входе и саму проверку
+func (t *Telegram) cleanupCaptcha(challenge *captchaChallenge) {
+	err := t.bot.DeleteMany([]tele.Editable{
+		tele.StoredMessage{MessageID: strconv.Itoa(challenge.ChallengeMessageID), ChatID: challenge.ChatID},
+		tele.StoredMessage{MessageID: strconv.Itoa(challenge.JoinMessageID), ChatID: challenge.ChatID},
+	})
+	if err != nil {
+		zap.L().Warn("Не удалось удалить сообщения проверки", zap.Error(err), zap.Int64("chat_id", challenge.ChatID))
+	}
+
+	err = t.redis.Del(captchaKey(challenge.ChatID, challenge.UserID))
+	if err != nil {
+		zap.L().Error("Не удалось удалить проверку", zap.Error(err), zap.Int64("chat_id", challenge.ChatID))
+	}
+}
+
+// cmdCaptcha показывает и меняет настройки проверки новых участников
+func (t *Telegram) cmdCaptcha(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	const usage = "Изменить настройки:\n" +
+		"/captcha on|off - включить или выключить проверку\n" +
+		"/captcha type button|math - кнопка или пример\n" +
+		"/captcha timeout 120 - время на ответ в секундах, от 30 до 3600"
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		state := "выключена"
+		if group.CaptchaEnabled {
+			state = "включена"
+		}
+		kind := "кнопка"
+		if group.CaptchaType == captchaMath {
+			kind = "пример"
+		}
+
+		return ctx.Reply(fmt.Sprintf("Проверка новых участников %s\nЗадание: %s\nВремя на ответ: %d сек.\n\n%s",
+			state, kind, group.CaptchaTimeout, usage))
+	}
+
+	var column string
+	switch {
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		group.CaptchaEnabled = args[0] == "on"
+		column = "CaptchaEnabled"
+	case len(args) == 2 && args[0] == "type" && (args[1] == captchaButton || args[1] == captchaMath):
+		group.CaptchaType = args[1]
+		column = "CaptchaType"
+	case len(args) == 2 && args[0] == "timeout":
+		timeout, err := strconv.Atoi(args[1])
+		if err != nil || timeout < 30 || timeout > 3600 {
+			return ctx.Reply("Некорректное время. Укажите от 30 до 3600 секунд")
+		}
+		group.CaptchaTimeout = timeout
+		column = "CaptchaTimeout"
+	default:
+		return ctx.Reply(usage)
+	}
+
+	err := t.saveModeratedGroup(group, column)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+
+	if group.CaptchaEnabled {
+		return ctx.Reply("Настройки проверки обновлены. Для работы боту нужно право блокировать участников")
+	}
+
+	return ctx.Reply("Настройки проверки обновлены, проверка выключена")
+}
@@ -0,0 +1,29 @@
+package telegram
+
+import "testing"
+
+func TestCaptchaOptions(t *testing.T) {
+	// Ответ - сумма двух чисел от 1 до 9. Варианты случайные, поэтому каждый ответ проверяется много раз
+	for answer := 2; answer <= 18; answer++ {
+		for i := 0; i < 100; i++ {
+			options := captchaOptions(answer)
+			if len(options) != 4 {
+				t.Fatalf("captchaOptions(%d) = %v, want 4 options", answer, options)
+			}
+
+			seen := map[int]bool{}
+			for _, option := range options {
+				if option < 2 || option > 18 {
+					t.Fatalf("captchaOptions(%d) = %v, option %d out of range", answer, options, option)
+				}
+				if seen[option] {
+					t.Fatalf("captchaOptions(%d) = %v, duplicate option %d", answer, options, option)
+				}
+				seen[option] = true
+			}
+			if !seen[answer] {
+				t.Fatalf("captchaOptions(%d) = %v, answer missing", answer, options)
+			}
+		}
+	}
+}
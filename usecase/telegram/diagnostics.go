@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Проблемы с правами бота, о которых администраторы получают одно уведомление в сутки
+const (
+	rightsProblemDelete   = "delete"   // не удалось удалить сообщение
+	rightsProblemSchedule = "schedule" // не удалось открыть или закрыть чат
+)
+
+// Как часто можно повторять уведомление об одной и той же проблеме с правами
+const rightsAlertInterval = 24 * time.Hour
+
+// Сколько хранится последняя ошибка планировщика
+const schedulerErrorTTL = 7 * 24 * time.Hour
+
+// Тексты уведомлений о проблемах с правами
+var rightsProblemTexts = map[string]string{
+	rightsProblemDelete:   "Бот не смог удалить сообщение в чате %s: не хватает права удалять сообщения.",
+	rightsProblemSchedule: "Бот не смог открыть или закрыть чат %s по расписанию: не хватает права блокировать участников.",
+}
+
+func rightsAlertKey(chatID int64, problem string) string {
+	return fmt.Sprintf("rights_alert:%d:%s", chatID, problem)
+}
+
+func schedulerErrorKey(chatID int64) string {
+	return fmt.Sprintf("scheduler_error:%d", chatID)
+}
+
+// schedulerError последняя ошибка планировщика в группе
+type schedulerError struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+// isRightsError проверяет, что запрос к API телеграма не выполнен из-за нехватки прав бота
+func isRightsError(err error) bool {
+	if errors.Is(err, tele.ErrNoRightsToDelete) || errors.Is(err, tele.ErrNoRightsToRestrict) {
+		return true
+	}
+
+	var apiErr *tele.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	description := strings.ToLower(apiErr.Description)
+
+	return strings.Contains(description, "not enough rights") ||
+		strings.Contains(description, "chat_admin_required") ||
+		strings.Contains(description, "need administrator rights")
+}
+
+// reportRightsError уведомляет администраторов чата, если ошибка вызвана нехваткой прав бота.
+// Об одной проблеме уведомление отправляется не чаще раза в сутки. Ошибка возвращается без изменений
+func (t *Telegram) reportRightsError(chatID int64, problem string, err error) error {
+	if err == nil || !isRightsError(err) {
+		return err
+	}
+
+	first, setErr := t.redis.SetNX(rightsAlertKey(chatID, problem), "1", rightsAlertInterval)
+	if setErr != nil {
+		zap.L().Error("Не удалось отметить уведомление о правах", zap.Error(setErr), zap.Int64("chat_id", chatID))
+		return err
+	}
+	if !first {
+		return err
+	}
+
+	chat, chatErr := t.bot.ChatByID(chatID)
+	if chatErr != nil {
+		chat = &tele.Chat{ID: chatID}
+	}
+
+	title := chat.Title
+	if title == "" {
+		title = fmt.Sprint(chatID)
+	}
+	text := fmt.Sprintf(rightsProblemTexts[problem], title) + "\nПроверьте права бота командой /diagnose в группе."
+
+	// Если ни один администратор не начинал диалог с ботом, пишем в саму группу
+	if t.notifyAdmins(chat, text) == 0 {
+		_, sendErr := t.bot.Send(chat, text)
+		if sendErr != nil {
+			zap.L().Warn("Не удалось уведомить о нехватке прав", zap.Error(sendErr), zap.Int64("chat_id", chatID))
+		}
+	}
+
+	return err
+}
+
+// resetRightsAlerts разрешает снова уведомлять о проблемах с правами, когда права восстановлены
+func (t *Telegram) resetRightsAlerts(chatID int64) {
+	for problem := range rightsProblemTexts {
+		err := t.redis.Del(rightsAlertKey(chatID, problem))
+		if err != nil {
+			zap.L().Error("Не удалось сбросить уведомление о правах", zap.Error(err), zap.Int64("chat_id", chatID))
+		}
+	}
+}
+
+// saveSchedulerError запоминает ошибку планировщика для /diagnose. nil стирает прошлую ошибку
+func (t *Telegram) saveSchedulerError(chatID int64, schedErr error) {
+	key := schedulerErrorKey(chatID)
+	if schedErr == nil {
+		err := t.redis.Del(key)
+		if err != nil {
+			zap.L().Error("Не удалось стереть ошибку планировщика", zap.Error(err), zap.Int64("chat_id", chatID))
+		}
+		return
+	}
+
+	data, err := json.Marshal(schedulerError{At: time.Now(), Error: schedErr.Error()})
+	if err == nil {
+		err = t.redis.SetWithTTL(key, data, schedulerErrorTTL)
+	}
+	if err != nil {
+		zap.L().Error("Не удалось сохранить ошибку планировщика", zap.Error(err), zap.Int64("chat_id", chatID))
+	}
+}
+
+// loadSchedulerError возвращает последнюю ошибку планировщика в группе, если она была
+func (t *Telegram) loadSchedulerError(chatID int64) (*schedulerError, bool) {
+	data, err := t.redis.GetBytes(schedulerErrorKey(chatID))
+	if err != nil {
+		return nil, false
+	}
+
+	var schedErr schedulerError
+	err = json.Unmarshal(data, &schedErr)
+	if err != nil {
+		return nil, false
+	}
+
+	return &schedErr, true
+}
+
+// missingBotRights возвращает права, которых не хватает боту для модерации чата.
+// Удаление нужно для ссылок и запрещенных слов, блокировка - для расписания, наказаний и проверки новичков
+func (t *Telegram) missingBotRights(chat *tele.Chat) ([]string, error) {
+	admins, err := t.chatAdmins(chat)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, admin := range admins {
+		if admin.User == nil || admin.User.ID != t.bot.Me.ID {
+			continue
+		}
+
+		var missing []string
+		if !admin.CanDeleteMessages {
+			missing = append(missing, "удаление сообщений")
+		}
+		if !admin.CanRestrictMembers {
+			missing = append(missing, "блокировка участников")
+		}
+		return missing, nil
+	}
+
+	return []string{"бот не администратор чата"}, nil
+}
+
+// scheduleProblems ищет ошибки в настройках расписания группы
+func scheduleProblems(group *database.ModeratedGroup) []string {
+	var problems []string
+
+	if group.TimeZone != "" {
+		if _, err := time.LoadLocation(group.TimeZone); err != nil {
+			problems = append(problems, fmt.Sprintf("часовой пояс %q не найден, используется пояс по умолчанию", group.TimeZone))
+		}
+	}
+
+	if len(group.ScheduleWindows) == 0 {
+		problems = append(problems, "нет ни одного окна закрытия, чат закрывается только по исключениям")
+	}
+	for _, window := range group.ScheduleWindows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("некорректное начало окна %s", window.Start))
+			continue
+		}
+		end, err := parseWindowEnd(window.End)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("некорректный конец окна %s", window.End))
+			continue
+		}
+		if start == end {
+			problems = append(problems, fmt.Sprintf("пустое окно %s %s-%s", weekdayNames[window.Weekday], window.Start, window.End))
+		}
+	}
+
+	return problems
+}
+
+// cmdDiagnose проверяет права бота, настройки расписания и показывает последнюю ошибку планировщика
+func (t *Telegram) cmdDiagnose(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Диагностика модерации\n\n")
+
+	if group.Disabled {
+		b.WriteString("Модерация выключена, включить: /moderate\n")
+	}
+
+	missing, err := t.missingBotRights(ctx.Chat())
+	switch {
+	case err != nil:
+		zap.L().Error("Не удалось проверить права бота", zap.Error(err))
+		b.WriteString("Права бота: не удалось проверить\n")
+	case len(missing) > 0:
+		b.WriteString("Права бота: не хватает - " + strings.Join(missing, ", ") + "\n")
+	default:
+		b.WriteString("Права бота: в порядке\n")
+		t.resetRightsAlerts(group.ChatID)
+	}
+
+	if group.ModerateScheduled {
+		problems := scheduleProblems(group)
+		if len(problems) == 0 {
+			b.WriteString("Расписание: в порядке\n")
+		} else {
+			b.WriteString("Расписание:\n- " + strings.Join(problems, "\n- ") + "\n")
+		}
+
+		expected := database.ScheduleStateOpen
+		if t.isClosedAt(group, time.Now()) {
+			expected = database.ScheduleStateClosed
+		}
+		if group.ScheduleState != expected {
+			b.WriteString("Состояние чата еще не совпадает с расписанием, планировщик повторит попытку в течение минуты\n")
+		}
+	} else {
+		b.WriteString("Расписание: выключено\n")
+	}
+
+	if schedErr, ok := t.loadSchedulerError(group.ChatID); ok {
+		at := schedErr.At.In(t.groupLocation(group)).Format("2006-01-02 15:04")
+		b.WriteString(fmt.Sprintf("Последняя ошибка планировщика (%s): %s\n", at, schedErr.Error))
+	} else {
+		b.WriteString("Ошибок планировщика нет\n")
+	}
+
+	return ctx.Reply(b.String())
+}
@@ -0,0 +1,225 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Действие антифлуда, при котором нарушитель не наказывается, а лишние сообщения только удаляются
+const floodDelete = "delete"
+
+func floodKey(chatID, userID int64) string {
+	return fmt.Sprintf("flood:%d:%d", chatID, userID)
+}
+
+func floodPunishedKey(chatID, userID int64) string {
+	return fmt.Sprintf("flood_punished:%d:%d", chatID, userID)
+}
+
+// Сколько хранятся сообщения участника для антифлуда. Окно группы не может быть длиннее
+const floodMaxWindow = time.Hour
+
+// countFlood записывает сообщение участника в скользящее окно антифлуда. Вызывается для каждого
+// сообщения в группе, в том числе команд, стикеров и опросов, до проверки настроек группы:
+// окно группы отсчитывается при проверке лимита в moderateFlood
+func (t *Telegram) countFlood(msg *tele.Message) {
+	if msg.Sender == nil || msg.LastEdit != 0 || isServiceMessage(msg) {
+		return
+	}
+
+	// Альбом считается одним сообщением
+	member := strconv.Itoa(msg.ID)
+	if msg.AlbumID != "" {
+		member = "album:" + msg.AlbumID
+	}
+
+	_, err := t.redis.SlidingWindowAdd(floodKey(msg.Chat.ID, msg.Sender.ID), member, floodMaxWindow)
+	if err != nil {
+		zap.L().Error("Не удалось посчитать сообщения для антифлуда", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+}
+
+// moderateFlood проверяет, сколько сообщений участник отправил за окно группы, и возвращает true,
+// если сообщение превысило лимит группы и уже обработано
+func (t *Telegram) moderateFlood(ctx tele.Context, group *database.ModeratedGroup) bool {
+	msg := ctx.Message()
+	if group.FloodLimit <= 0 || group.FloodWindow <= 0 || msg.LastEdit != 0 {
+		return false
+	}
+
+	window := time.Duration(group.FloodWindow) * time.Second
+	key := floodKey(msg.Chat.ID, ctx.Sender().ID)
+
+	count, err := t.redis.SlidingWindowCount(key, window)
+	if err != nil {
+		zap.L().Error("Не удалось посчитать сообщения для антифлуда", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+		return false
+	}
+	if count <= int64(group.FloodLimit) {
+		return false
+	}
+
+	rule := formatFlood(group)
+	if group.FloodAction == floodDelete || group.FloodAction == "" {
+		err = t.deleteMessage(msg)
+		if err != nil {
+			zap.L().Error("Не удалось удалить сообщение", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+			return true
+		}
+		t.logAction(&database.ModerationAction{
+			ChatID:   msg.Chat.ID,
+			TargetID: ctx.Sender().ID,
+			Action:   actionDelete,
+			Rule:     rule,
+			Excerpt:  messageExcerpt(msg),
+		})
+		return true
+	}
+
+	// Наказываем один раз за окно, даже если сообщения обрабатываются разными репликами
+	first, err := t.redis.SetNX(floodPunishedKey(msg.Chat.ID, ctx.Sender().ID), "1", window)
+	if err != nil {
+		zap.L().Error("Не удалось отметить наказание за флуд", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+	if err == nil && !first {
+		if t.deleteMessage(msg) == nil {
+			t.logAction(&database.ModerationAction{
+				ChatID:   msg.Chat.ID,
+				TargetID: ctx.Sender().ID,
+				Action:   actionDelete,
+				Rule:     rule,
+				Excerpt:  messageExcerpt(msg),
+			})
+		}
+		return true
+	}
+
+	duration := time.Duration(group.FloodDuration) * time.Second
+	err = t.applySanction(msg.Chat, ctx.Sender(), group.FloodAction, duration)
+	if err != nil {
+		zap.L().Error("Не удалось наказать за флуд", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	} else {
+		t.logAction(&database.ModerationAction{
+			ChatID:   msg.Chat.ID,
+			TargetID: ctx.Sender().ID,
+			Action:   group.FloodAction,
+			Duration: group.FloodDuration,
+			Rule:     rule,
+			Excerpt:  messageExcerpt(msg),
+		})
+	}
+
+	// Вместе с наказанием убираем все сообщения из окна
+	t.deleteFloodMessages(msg, key, window)
+
+	_ = ctx.Send(fmt.Sprintf("%s: %s за флуд", formatUser(ctx.Sender()), formatSanction(group.FloodAction, duration)))
+
+	return true
+}
+
+// deleteFloodMessages удаляет все сообщения участника, попавшие в окно антифлуда
+func (t *Telegram) deleteFloodMessages(msg *tele.Message, key string, window time.Duration) {
+	ids, err := t.redis.SlidingWindowMembers(key, window)
+	if err != nil {
+		zap.L().Error("Не удалось получить сообщения флуда", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	messages := []tele.Editable{msg}
+	current := strconv.Itoa(msg.ID)
+	for _, id := range ids {
+		// Альбомы удаляет deleteMessage вместе с текущим сообщением или раньше
+		if id != current && !strings.HasPrefix(id, "album:") {
+			messages = append(messages, tele.StoredMessage{MessageID: id, ChatID: msg.Chat.ID})
+		}
+	}
+
+	err = t.bot.DeleteMany(messages)
+	if err != nil {
+		zap.L().Error("Не удалось удалить сообщения флуда", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+}
+
+// formatFlood выводит настройки антифлуда группы
+func formatFlood(group *database.ModeratedGroup) string {
+	if group.FloodLimit <= 0 || group.FloodWindow <= 0 {
+		return "Антифлуд выключен"
+	}
+
+	action := "лишние сообщения удаляются"
+	if group.FloodAction != floodDelete && group.FloodAction != "" {
+		action = formatSanction(group.FloodAction, time.Duration(group.FloodDuration)*time.Second)
+	}
+
+	return fmt.Sprintf("Больше %d сообщений за %d сек.: %s", group.FloodLimit, group.FloodWindow, action)
+}
+
+// cmdFlood показывает и меняет настройки антифлуда:
+// /flood N T delete|kick|mute [срок] или /flood off
+func (t *Telegram) cmdFlood(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	const usage = "Использование: /flood N T delete|kick|mute [срок] - не больше N сообщений за T секунд, например:\n" +
+		"/flood 10 5 mute 10m\n" +
+		"/flood 5 3 delete\n" +
+		"/flood off - выключить"
+
+	args := ctx.Args()
+	switch {
+	case len(args) == 0:
+		return ctx.Reply(formatFlood(group) + "\n\n" + usage)
+	case len(args) == 1 && strings.EqualFold(args[0], "off"):
+		group.FloodLimit = 0
+	case len(args) >= 3:
+		limit, err := strconv.Atoi(args[0])
+		if err != nil || limit <= 0 {
+			return ctx.Reply("Некорректное количество сообщений.\n\n" + usage)
+		}
+		window, err := strconv.Atoi(args[1])
+		if err != nil || window <= 0 || time.Duration(window)*time.Second > floodMaxWindow {
+			return ctx.Reply("Некорректное окно, укажите от 1 до 3600 секунд.\n\n" + usage)
+		}
+
+		action := strings.ToLower(args[2])
+		var duration time.Duration
+		switch action {
+		case floodDelete, database.SanctionKick:
+			if len(args) != 3 {
+				return ctx.Reply(usage)
+			}
+		case database.SanctionMute:
+			if len(args) != 4 {
+				return ctx.Reply("Укажите срок мута, например: /flood 10 5 mute 10m")
+			}
+			duration, err = parseDuration(args[3])
+			if err != nil || duration > maxSanctionDuration {
+				return ctx.Reply("Некорректный срок мута, например: 10m, 1h, 1d")
+			}
+		default:
+			return ctx.Reply(usage)
+		}
+
+		group.FloodLimit = limit
+		group.FloodWindow = window
+		group.FloodAction = action
+		group.FloodDuration = int64(duration / time.Second)
+	default:
+		return ctx.Reply(usage)
+	}
+
+	err := t.saveModeratedGroup(group, "FloodLimit", "FloodWindow", "FloodAction", "FloodDuration")
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+
+	return ctx.Reply(formatFlood(group))
+}
@@ -0,0 +1,242 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Имя глобального белого списка для перелистывания
+const listGlobalWhitelist = "global_whitelist"
+
+// Глобальный белый список нужен при каждой проверке ссылок, поэтому кешируется в редисе.
+// Изменения командой /whitelist сбрасывают кеш сразу, срок нужен на случай изменений напрямую в базе
+const (
+	globalWhitelistKey = "global_whitelist:entries"
+	globalWhitelistTTL = 10 * time.Minute
+)
+
+// Кнопки подтверждения очистки глобального белого списка
+var (
+	whitelistClearButton  = &tele.Btn{Unique: "whitelist_clear"}
+	whitelistCancelButton = &tele.Btn{Unique: "whitelist_cancel"}
+)
+
+// Подсказка по команде /whitelist
+const globalWhitelistHelp = "Глобальный белый список действует во всех группах:\n" +
+	"/whitelist запись - добавить запись\n" +
+	"/whitelist list - показать список\n" +
+	"/whitelist remove номер|запись - удалить запись\n" +
+	"/whitelist clear - очистить список\n\n" + whitelistHelp
+
+var errGlobalAdminOnly = errors.New("Эта команда доступна только владельцам и суперадминистраторам бота в личной переписке с ботом")
+
+// setupGlobalWhitelist регистрирует команду глобального белого списка и кнопки подтверждения
+func (t *Telegram) setupGlobalWhitelist() {
+	t.bot.Handle("/whitelist", t.cmdWhitelist)
+	t.bot.Handle(whitelistClearButton, t.onWhitelistClear)
+	t.bot.Handle(whitelistCancelButton, t.onWhitelistCancel)
+
+	t.registerList(listGlobalWhitelist, t.globalWhitelistList)
+}
+
+// checkGlobalAdmin проверяет, что команда пришла от владельца или суперадминистратора в личной переписке
+func (t *Telegram) checkGlobalAdmin(ctx tele.Context) error {
+	if ctx.Chat() == nil || ctx.Chat().Type != tele.ChatPrivate || !t.auth.isSuperadmin(ctx.Sender().ID) {
+		return errGlobalAdminOnly
+	}
+
+	return nil
+}
+
+// cmdWhitelist обрабатывает команду /whitelist: добавление, просмотр, удаление и очистка глобального белого списка
+func (t *Telegram) cmdWhitelist(ctx tele.Context) error {
+	err := t.checkGlobalAdmin(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	args := ctx.Args()
+	if len(args) < 1 {
+		return ctx.Reply(globalWhitelistHelp)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "list":
+		return t.sendList(ctx, listGlobalWhitelist)
+	case "remove":
+		return t.removeFromGlobalWhitelist(ctx, args[1:])
+	case "clear":
+		markup := &tele.ReplyMarkup{}
+		markup.Inline(markup.Row(
+			markup.Data("Да, очистить", whitelistClearButton.Unique),
+			markup.Data("Отмена", whitelistCancelButton.Unique),
+		))
+		return ctx.Reply("Удалить все записи глобального белого списка?", markup)
+	case "add":
+		args = args[1:]
+	}
+
+	// Добавляем запись в глобальный белый список
+	entry, err := parseWhitelistEntry(strings.Join(args, " "))
+	if err != nil {
+		return ctx.Reply("Некорректная запись белого списка.\n\n" + whitelistHelp)
+	}
+
+	added, err := t.db.AddGlobalWhitelistEntry(&database.GlobalWhitelistEntry{
+		Kind:    entry.Kind,
+		Pattern: entry.Pattern,
+		AddedBy: ctx.Sender().ID,
+	})
+	if err != nil {
+		zap.L().Error("Не удалось добавить в белый список", zap.Error(err))
+		return ctx.Reply("Ошибка при добавлении в белый список")
+	}
+	if !added {
+		return ctx.Reply(fmt.Sprintf("'%s' уже есть в глобальном белом списке", entry))
+	}
+	t.invalidateGlobalWhitelist()
+
+	return ctx.Reply(fmt.Sprintf("'%s' добавлено в глобальный белый список", entry))
+}
+
+// removeFromGlobalWhitelist удаляет запись глобального белого списка по номеру из /whitelist list или по самой записи
+func (t *Telegram) removeFromGlobalWhitelist(ctx tele.Context, args []string) error {
+	if len(args) == 0 {
+		return ctx.Reply("Пожалуйста, укажите номер из /whitelist list или саму запись, например: /whitelist remove example.com")
+	}
+
+	entries, err := t.db.GetGlobalWhitelist()
+	if err != nil {
+		zap.L().Error("Не удалось получить глобальный белый список", zap.Error(err))
+		return ctx.Reply("Ошибка при получении белого списка")
+	}
+
+	index := -1
+	if number, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if number >= 1 && number <= len(entries) {
+			index = number - 1
+		}
+	} else if entry, err := parseWhitelistEntry(strings.Join(args, " ")); err == nil {
+		for i, item := range entries {
+			if item.Kind == entry.Kind && item.Pattern == entry.Pattern {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return ctx.Reply("Запись не найдена, посмотрите список командой /whitelist list")
+	}
+
+	err = t.db.DeleteGlobalWhitelistEntry(entries[index].ID)
+	if err != nil {
+		zap.L().Error("Не удалось удалить запись белого списка", zap.Error(err))
+		return ctx.Reply("Ошибка при удалении из белого списка")
+	}
+	t.invalidateGlobalWhitelist()
+
+	removed := whitelistEntry{Kind: entries[index].Kind, Pattern: entries[index].Pattern}
+
+	return ctx.Reply(fmt.Sprintf("'%s' удалено из глобального белого списка", removed))
+}
+
+// onWhitelistClear очищает глобальный белый список после подтверждения
+func (t *Telegram) onWhitelistClear(ctx tele.Context) error {
+	err := t.checkGlobalAdmin(ctx)
+	if err != nil {
+		return ctx.Respond(&tele.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+
+	err = t.db.ClearGlobalWhitelist()
+	if err != nil {
+		zap.L().Error("Не удалось очистить глобальный белый список", zap.Error(err))
+		return ctx.Respond(&tele.CallbackResponse{Text: "Ошибка при очистке белого списка", ShowAlert: true})
+	}
+	t.invalidateGlobalWhitelist()
+
+	_ = ctx.Edit("Глобальный белый список очищен")
+
+	return ctx.Respond()
+}
+
+// onWhitelistCancel отменяет очистку глобального белого списка
+func (t *Telegram) onWhitelistCancel(ctx tele.Context) error {
+	_ = ctx.Edit("Очистка глобального белого списка отменена")
+
+	return ctx.Respond()
+}
+
+// globalWhitelistList собирает глобальный белый список для вывода по страницам
+func (t *Telegram) globalWhitelistList(ctx tele.Context, _ []string) (string, []string, error) {
+	err := t.checkGlobalAdmin(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	entries, err := t.db.GetGlobalWhitelist()
+	if err != nil {
+		zap.L().Error("Не удалось получить глобальный белый список", zap.Error(err))
+		return "", nil, errors.New("Ошибка при получении белого списка")
+	}
+
+	items := make([]string, 0, len(entries))
+	for _, item := range entries {
+		entry := whitelistEntry{Kind: item.Kind, Pattern: item.Pattern}
+		added := item.CreatedAt.Format("2006-01-02 15:04")
+		if item.AddedBy != 0 {
+			added += fmt.Sprintf(", добавил %d", item.AddedBy)
+		}
+		items = append(items, fmt.Sprintf("%s (%s)", entry, added))
+	}
+
+	return "Глобальный белый список. Удалить: /whitelist remove номер", items, nil
+}
+
+// getGlobalWhitelist получает глобальный белый список из кеша, а при его отсутствии - из базы
+func (t *Telegram) getGlobalWhitelist() ([]whitelistEntry, error) {
+	data, err := t.redis.GetBytes(globalWhitelistKey)
+	if err == nil {
+		var whitelist []whitelistEntry
+		err = json.Unmarshal(data, &whitelist)
+		if err == nil {
+			return whitelist, nil
+		}
+		zap.L().Warn("Некорректный глобальный белый список в редисе", zap.Error(err))
+	}
+
+	entries, err := t.db.GetGlobalWhitelist()
+	if err != nil {
+		return nil, err
+	}
+
+	whitelist := make([]whitelistEntry, 0, len(entries))
+	for _, item := range entries {
+		whitelist = append(whitelist, whitelistEntry{Kind: item.Kind, Pattern: item.Pattern})
+	}
+
+	data, err = json.Marshal(whitelist)
+	if err == nil {
+		err = t.redis.SetWithTTL(globalWhitelistKey, data, globalWhitelistTTL)
+	}
+	if err != nil {
+		zap.L().Error("Не удалось сохранить глобальный белый список в редис", zap.Error(err))
+	}
+
+	return whitelist, nil
+}
+
+// invalidateGlobalWhitelist сбрасывает кеш глобального белого списка на всех копиях бота
+func (t *Telegram) invalidateGlobalWhitelist() {
+	err := t.redis.Del(globalWhitelistKey)
+	if err != nil {
+		zap.L().Error("Не удалось сбросить кеш глобального белого списка", zap.Error(err))
+	}
+}
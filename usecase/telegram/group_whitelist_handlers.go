@@ -0,0 +1,236 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Имена списков белого списка группы для перелистывания
+const (
+	listGroupLinks   = "links"
+	listTrustedUsers = "trusted"
+)
+
+// setupGroupWhitelist регистрирует команды белого списка группы
+func (t *Telegram) setupGroupWhitelist() {
+	t.bot.Handle("/allow_link", t.cmdAllowLink)
+	t.bot.Handle("/remove_link", t.cmdRemoveLink)
+	t.bot.Handle("/links", t.cmdLinks)
+	t.bot.Handle("/trust", t.cmdTrust)
+	t.bot.Handle("/untrust", t.cmdUntrust)
+	t.bot.Handle("/trusted", t.cmdTrusted)
+
+	t.registerList(listGroupLinks, t.groupLinksList)
+	t.registerList(listTrustedUsers, t.trustedUsersList)
+}
+
+// cmdAllowLink добавляет запись в белый список ссылок группы
+func (t *Telegram) cmdAllowLink(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		return ctx.Reply("Пожалуйста, укажите запись, например: /allow_link example.com\n\n" + whitelistHelp)
+	}
+
+	entry, err := parseWhitelistEntry(strings.Join(args, " "))
+	if err != nil {
+		return ctx.Reply("Некорректная запись белого списка.\n\n" + whitelistHelp)
+	}
+
+	// Записи, сохраненные до появления типов, хранятся без типа, поэтому сравниваются после разбора
+	for _, link := range group.WhitelistedLinks {
+		if linkEntry(link) == entry {
+			return ctx.Reply(fmt.Sprintf("'%s' уже есть в белом списке группы", entry))
+		}
+	}
+
+	added, err := t.db.AddWhitelistedLink(&database.WhitelistedLink{
+		ChatID: group.ChatID,
+		Kind:   entry.Kind,
+		Link:   entry.Pattern,
+	})
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	if !added {
+		return ctx.Reply(fmt.Sprintf("'%s' уже есть в белом списке группы", entry))
+	}
+
+	return ctx.Reply(fmt.Sprintf("'%s' добавлено в белый список группы", entry))
+}
+
+// cmdRemoveLink удаляет запись из белого списка ссылок группы по номеру из /links или по самой записи
+func (t *Telegram) cmdRemoveLink(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		return ctx.Reply("Пожалуйста, укажите номер из /links или саму запись, например: /remove_link example.com")
+	}
+
+	index := -1
+	if number, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if number >= 1 && number <= len(group.WhitelistedLinks) {
+			index = number - 1
+		}
+	} else if entry, err := parseWhitelistEntry(strings.Join(args, " ")); err == nil {
+		for i, link := range group.WhitelistedLinks {
+			if linkEntry(link) == entry {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return ctx.Reply("Запись не найдена, посмотрите список командой /links")
+	}
+
+	removed := group.WhitelistedLinks[index]
+	deleted, err := t.db.DeleteWhitelistedLink(group.ChatID, removed.ID)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	if !deleted {
+		return ctx.Reply("Запись уже удалена, посмотрите список командой /links")
+	}
+
+	return ctx.Reply(fmt.Sprintf("'%s' удалено из белого списка группы", linkEntry(removed)))
+}
+
+// cmdLinks показывает белый список ссылок группы
+func (t *Telegram) cmdLinks(ctx tele.Context) error {
+	return t.sendList(ctx, listGroupLinks)
+}
+
+// groupLinksList собирает белый список ссылок группы для вывода по страницам
+func (t *Telegram) groupLinksList(ctx tele.Context, _ []string) (string, []string, error) {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	items := make([]string, 0, len(group.WhitelistedLinks))
+	for _, link := range group.WhitelistedLinks {
+		items = append(items, linkEntry(link).String())
+	}
+
+	return "Белый список ссылок группы. Добавить: /allow_link запись, удалить: /remove_link номер", items, nil
+}
+
+// cmdTrust добавляет пользователя в доверенные: его сообщения не проверяются модерацией
+func (t *Telegram) cmdTrust(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	user, _, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	added, err := t.db.AddWhitelistedUser(&database.WhitelistedUser{ChatID: group.ChatID, UserID: user.ID})
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	if !added {
+		return ctx.Reply(fmt.Sprintf("%s уже в списке доверенных", formatUser(user)))
+	}
+
+	return ctx.Reply(fmt.Sprintf("%s добавлен в список доверенных", formatUser(user)))
+}
+
+// cmdUntrust убирает пользователя из доверенных
+func (t *Telegram) cmdUntrust(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	user, _, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	deleted, err := t.db.DeleteWhitelistedUser(group.ChatID, user.ID)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	if !deleted {
+		return ctx.Reply(fmt.Sprintf("%s не в списке доверенных", formatUser(user)))
+	}
+
+	return ctx.Reply(fmt.Sprintf("%s убран из списка доверенных", formatUser(user)))
+}
+
+// cmdTrusted показывает доверенных пользователей группы
+func (t *Telegram) cmdTrusted(ctx tele.Context) error {
+	return t.sendList(ctx, listTrustedUsers)
+}
+
+// trustedUsersList собирает доверенных пользователей группы для вывода по страницам.
+// Имена берутся из базы пользователей, для незнакомых боту выводится только ID
+func (t *Telegram) trustedUsersList(ctx tele.Context, _ []string) (string, []string, error) {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ids := make([]int64, 0, len(group.WhitelistedUsers))
+	for _, item := range group.WhitelistedUsers {
+		ids = append(ids, item.UserID)
+	}
+
+	users := t.knownUsers(ids)
+	items := make([]string, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, formatUser(users[id]))
+	}
+
+	return "Доверенные пользователи группы. Добавить: /trust, убрать: /untrust", items, nil
+}
+
+// linkEntry приводит запись белого списка группы к типизированному виду
+func linkEntry(link database.WhitelistedLink) whitelistEntry {
+	return whitelistEntry{Kind: link.Kind, Pattern: link.Link}
+}
+
+// legacyLinkEntry определяет тип записи белого списка группы, сохраненной без типа.
+// Запись, которая не разбирается, остается доменом, как и выводилась раньше
+func legacyLinkEntry(link string) whitelistEntry {
+	entry, err := parseWhitelistEntry(link)
+	if err != nil {
+		zap.L().Warn("Некорректная запись белого списка группы", zap.String("value", link), zap.Error(err))
+		return whitelistEntry{Kind: whitelistDomain, Pattern: link}
+	}
+
+	return entry
+}
+
+// typeLegacyWhitelistedLinks проставляет тип записям белого списка групп, сохраненным без него
+func (t *Telegram) typeLegacyWhitelistedLinks() error {
+	return t.db.TypeLegacyWhitelistedLinks(func(link string) (string, string) {
+		entry := legacyLinkEntry(link)
+		return entry.Kind, entry.Pattern
+	})
+}
@@ -8,18 +8,25 @@ import (
 	"time"
 )
 
+// loadUser возвращает отправителя из базы. Учет пользователей пишет в базу пачками,
+// поэтому нового пользователя сохраняем сразу, не дожидаясь записи буфера
 func (t *Telegram) loadUser(ctx tele.Context) (*database.User, error) {
 	user, err := t.db.GetUserByID(ctx.Sender().ID)
 	if err != nil {
+		now := time.Now()
 		user := &database.User{
-			ID:        ctx.Sender().ID,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			FirstName: ctx.Sender().FirstName,
-			LastName:  ctx.Sender().LastName,
-			Username:  ctx.Sender().Username,
+			ID:           ctx.Sender().ID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			FirstName:    ctx.Sender().FirstName,
+			LastName:     ctx.Sender().LastName,
+			Username:     ctx.Sender().Username,
+			LanguageCode: ctx.Sender().LanguageCode,
+			IsBot:        ctx.Sender().IsBot,
+			IsPremium:    ctx.Sender().IsPremium,
+			LastSeenAt:   &now,
 		}
-		err := t.db.CreateUser(user)
+		err := t.db.SaveUsers([]database.User{*user})
 		if err != nil {
 			zap.L().Error("failed to create user", zap.Error(err))
 			return nil, err
@@ -59,12 +66,6 @@ func (t *Telegram) cmdStart(ctx tele.Context) error {
 	return nil
 }
 
-func (t *Telegram) cmdBan(ctx tele.Context) error {
-	_ = ctx.Send("Эту команду только администраторы могут использовать")
-
-	return nil
-}
-
 func (t *Telegram) cmdCountUsers(ctx tele.Context) error {
 	// ты можешь юзать как готовые методы из database, так и юзать напрямую клиент базы (но я бы не советовал)
 	// t.db.CountUsers() - готовый метод который надо сделать в gateway/database и вызывать его
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"fmt"
+	"regexp"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Типы ссылок, которые находит модерация. Политика группы может разрешать каждый тип отдельно
+const (
+	linkURL         = "url"          // ссылка или домен в тексте
+	linkTextLink    = "text_link"    // ссылка, спрятанная под текстом
+	linkMention     = "mention"      // @username
+	linkTextMention = "text_mention" // упоминание пользователя без юзернейма
+	linkInvite      = "invite"       // пригласительная ссылка в телеграм-чат
+	linkButton      = "button"       // ссылка в кнопке под сообщением
+)
+
+// Все типы ссылок с описаниями для команды /link_policy
+var linkTypes = []struct {
+	Type        string
+	Description string
+}{
+	{linkURL, "ссылки и домены в тексте"},
+	{linkTextLink, "ссылки, спрятанные под текстом"},
+	{linkMention, "упоминания @username"},
+	{linkTextMention, "упоминания пользователей без юзернейма"},
+	{linkInvite, "приглашения в телеграм-чаты"},
+	{linkButton, "ссылки в кнопках"},
+}
+
+// Домены верхнего уровня, по которым запасная проверка узнает адрес без схемы.
+// Список ограничен, чтобы имена файлов вроде config.yml и node.js не считались ссылками
+const fallbackTLDs = "com|net|org|info|biz|io|me|co|app|dev|xyz|top|site|online|club|shop|store|link|click|live|pro|" +
+	"tech|vip|win|bet|ru|su|ua|by|kz|uz|de|uk|us|eu|cc|tk|ml|ga|cf|gq|ly|gl|gg|to|tv|ws"
+
+// Регулярные выражения для запасной проверки, когда телеграм не прислал разметку сообщения.
+// Разметке телеграма доверяем, поэтому без нее ссылкой считается только адрес со схемой,
+// с www или с известным доменом верхнего уровня
+var (
+	fallbackURLRe     = regexp.MustCompile(`(?i)\b(?:(?:https?|tg)://\S+|www\.\S+|(?:[a-z0-9-]+\.)+(?:` + fallbackTLDs + `)\b(?:/\S*)?)`)
+	fallbackMentionRe = regexp.MustCompile(`(?:^|[^\w.@])(@\w{5,32})\b`)
+	inviteRe          = regexp.MustCompile(`(?i)(?:t\.me|telegram\.me|telegram\.dog)/(?:\+|joinchat/)`)
+)
+
+// linkFinding ссылка, найденная в сообщении
+type linkFinding struct {
+	Type  string
+	Value string
+}
+
+// findLinks собирает все ссылки из сообщения: из разметки текста и подписи к медиа,
+// а также из кнопок под сообщением. Если разметки нет, текст проверяется регулярными выражениями
+func findLinks(msg *tele.Message) []linkFinding {
+	var findings []linkFinding
+
+	text, entities := msg.Text, msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+
+	for _, entity := range entities {
+		switch entity.Type {
+		case tele.EntityURL:
+			findings = append(findings, classifyURL(linkURL, msg.EntityText(entity)))
+		case tele.EntityTextLink:
+			findings = append(findings, classifyURL(linkTextLink, entity.URL))
+		case tele.EntityMention:
+			findings = append(findings, linkFinding{Type: linkMention, Value: msg.EntityText(entity)})
+		case tele.EntityTMention:
+			value := msg.EntityText(entity)
+			if entity.User != nil {
+				value = fmt.Sprintf("tg://user?id=%d", entity.User.ID)
+			}
+			findings = append(findings, linkFinding{Type: linkTextMention, Value: value})
+		}
+	}
+
+	if len(entities) == 0 && text != "" {
+		findings = append(findings, findLinksByRegexp(text)...)
+	}
+
+	if msg.ReplyMarkup != nil {
+		for _, row := range msg.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.URL != "" {
+					findings = append(findings, classifyURL(linkButton, button.URL))
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// findLinksByRegexp ищет ссылки и упоминания в тексте без разметки.
+// Адреса почты не считаются упоминаниями
+func findLinksByRegexp(text string) []linkFinding {
+	var findings []linkFinding
+
+	for _, loc := range fallbackURLRe.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		// Части адреса почты до и после @ не ссылки
+		if (start > 0 && text[start-1] == '@') || (end < len(text) && text[end] == '@') {
+			continue
+		}
+		findings = append(findings, classifyURL(linkURL, text[start:end]))
+	}
+
+	for _, match := range fallbackMentionRe.FindAllStringSubmatch(text, -1) {
+		findings = append(findings, linkFinding{Type: linkMention, Value: match[1]})
+	}
+
+	return findings
+}
+
+// classifyURL определяет, является ли ссылка приглашением в телеграм-чат
+func classifyURL(linkType string, url string) linkFinding {
+	if inviteRe.MatchString(url) {
+		return linkFinding{Type: linkInvite, Value: url}
+	}
+
+	return linkFinding{Type: linkType, Value: url}
+}
+
+// isLinkTypeAllowed проверяет, разрешен ли тип ссылок политикой группы
+func isLinkTypeAllowed(allowed []string, linkType string) bool {
+	for _, item := range allowed {
+		if item == linkType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindLinksByRegexp(t *testing.T) {
+	tests := []struct {
+		text string
+		want []linkFinding
+	}{
+		{text: "просто текст без ссылок", want: nil},
+		{text: "смотри https://example.com/page", want: []linkFinding{{Type: linkURL, Value: "https://example.com/page"}}},
+		{text: "заходи на www.example.org", want: []linkFinding{{Type: linkURL, Value: "www.example.org"}}},
+		{text: "сайт shop.example.ru/sale тут", want: []linkFinding{{Type: linkURL, Value: "shop.example.ru/sale"}}},
+		{text: "открой tg://resolve?domain=durov", want: []linkFinding{{Type: linkURL, Value: "tg://resolve?domain=durov"}}},
+		{text: "вступай https://t.me/+AbCdEf", want: []linkFinding{{Type: linkInvite, Value: "https://t.me/+AbCdEf"}}},
+		{text: "t.me/joinchat/AbCdEf", want: []linkFinding{{Type: linkInvite, Value: "t.me/joinchat/AbCdEf"}}},
+		{text: "пиши @durov_news", want: []linkFinding{{Type: linkMention, Value: "@durov_news"}}},
+		{text: "@channel в начале", want: []linkFinding{{Type: linkMention, Value: "@channel"}}},
+		{text: "короткий @abc", want: nil},
+		{text: "почта user@mail.ru и admin@example.com", want: nil},
+		{text: "файлы config.yml и node.js", want: nil},
+		{
+			text: "example.com и @example_chat",
+			want: []linkFinding{
+				{Type: linkURL, Value: "example.com"},
+				{Type: linkMention, Value: "@example_chat"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := findLinksByRegexp(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findLinksByRegexp(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
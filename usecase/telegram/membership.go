@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Как часто одно и то же сообщение обновляет запись о чате и участнике.
+// Чаще писать в базу нет смысла: время последней активности нужно с точностью до минут
+const (
+	chatSeenInterval   = 10 * time.Minute
+	memberSeenInterval = 5 * time.Minute
+)
+
+func chatSeenKey(chatID int64) string {
+	return fmt.Sprintf("seen_chat:%d", chatID)
+}
+
+func memberSeenKey(chatID, userID int64) string {
+	return fmt.Sprintf("seen_member:%d:%d", chatID, userID)
+}
+
+// memberStatus приводит статус участника из телеграма к статусу в базе.
+// Ограниченный участник, который вышел из чата, считается вышедшим
+func memberStatus(member *tele.ChatMember) string {
+	if member.Role == tele.Restricted && !member.Member {
+		return database.ChatMemberLeft
+	}
+
+	return string(member.Role)
+}
+
+// trackMembership middleware, которое по сообщениям в группах обновляет запись о чате,
+// время последней активности отправителя и вступления новых участников, а также считает
+// сообщения для антифлуда
+func (t *Telegram) trackMembership(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(ctx tele.Context) error {
+		msg := ctx.Message()
+		if msg != nil && ctx.Callback() == nil && isGroupChat(msg.Chat) {
+			t.trackMessage(msg)
+			t.countFlood(msg)
+		}
+
+		return next(ctx)
+	}
+}
+
+// trackMessage записывает чат и участников по сообщению
+func (t *Telegram) trackMessage(msg *tele.Message) {
+	logger := zap.L().With(zap.Int64("chat_id", msg.Chat.ID))
+	now := time.Now()
+
+	if t.firstSeen(chatSeenKey(msg.Chat.ID), chatSeenInterval) {
+		err := t.db.SaveChat(&database.Chat{
+			ID:       msg.Chat.ID,
+			Title:    msg.Chat.Title,
+			Type:     string(msg.Chat.Type),
+			Username: msg.Chat.Username,
+		}, "title", "type", "username")
+		if err != nil {
+			logger.Error("Не удалось сохранить чат", zap.Error(err))
+		}
+	}
+
+	// Сообщения от имени каналов и анонимных администраторов не относятся к участникам
+	if msg.Sender != nil && msg.SenderChat == nil && t.firstSeen(memberSeenKey(msg.Chat.ID, msg.Sender.ID), memberSeenInterval) {
+		err := t.db.TouchChatMember(msg.Chat.ID, msg.Sender.ID, now)
+		if err != nil {
+			logger.Error("Не удалось обновить участника", zap.Error(err), zap.Int64("user_id", msg.Sender.ID))
+		}
+	}
+
+	users := msg.UsersJoined
+	if len(users) == 0 && msg.UserJoined != nil {
+		users = []tele.User{*msg.UserJoined}
+	}
+	for _, user := range users {
+		err := t.db.SetChatMemberStatus(msg.Chat.ID, user.ID, string(tele.Member), now)
+		if err != nil {
+			logger.Error("Не удалось записать вступление участника", zap.Error(err), zap.Int64("user_id", user.ID))
+		}
+	}
+}
+
+// firstSeen возвращает true не чаще раза в интервал для одного ключа. Если редис недоступен,
+// запись в базу не пропускается
+func (t *Telegram) firstSeen(key string, interval time.Duration) bool {
+	first, err := t.redis.SetNX(key, "1", interval)
+	if err != nil {
+		return true
+	}
+
+	return first
+}
+
+// onUserLeft записывает выход участника по служебному сообщению
+func (t *Telegram) onUserLeft(ctx tele.Context) error {
+	msg := ctx.Message()
+	if msg == nil || msg.UserLeft == nil || !isGroupChat(msg.Chat) {
+		return nil
+	}
+
+	err := t.db.SetChatMemberStatus(msg.Chat.ID, msg.UserLeft.ID, database.ChatMemberLeft, time.Now())
+	if err != nil {
+		zap.L().Error("Не удалось записать выход участника", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+	}
+
+	return nil
+}
+
+// recordMemberStatus сохраняет статус участника из обновления chat_member
+func (t *Telegram) recordMemberStatus(update *tele.ChatMemberUpdate) {
+	if update.NewChatMember == nil || update.NewChatMember.User == nil || !isGroupChat(update.Chat) {
+		return
+	}
+
+	err := t.db.SetChatMemberStatus(update.Chat.ID, update.NewChatMember.User.ID, memberStatus(update.NewChatMember), update.Time())
+	if err != nil {
+		zap.L().Error("Не удалось сохранить статус участника",
+			zap.Error(err),
+			zap.Int64("chat_id", update.Chat.ID),
+			zap.Int64("user_id", update.NewChatMember.User.ID))
+	}
+}
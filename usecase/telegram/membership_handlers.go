@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Названия статусов участника
+var memberStatusNames = map[string]string{
+	string(tele.Creator):       "создатель",
+	string(tele.Administrator): "администратор",
+	string(tele.Member):        "участник",
+	string(tele.Restricted):    "ограничен",
+	database.ChatMemberLeft:    "вышел",
+	database.ChatMemberKicked:  "исключен",
+}
+
+// setupMembership регистрирует команду истории участия
+func (t *Telegram) setupMembership() {
+	t.bot.Handle("/whois", t.cmdWhois)
+}
+
+// cmdWhois показывает участие пользователя в группах. В группе администраторам - когда участник
+// вступил и когда бот видел его последний раз, в личной переписке владельцам и суперадминистраторам -
+// все группы с ботом, в которых он состоит
+func (t *Telegram) cmdWhois(ctx tele.Context) error {
+	group := isGroupChat(ctx.Chat())
+	if group && !t.auth.isAdmin(ctx.Chat(), ctx.Sender()) {
+		return ctx.Reply(errAdminOnly.Error())
+	}
+	if !group && !t.auth.isSuperadmin(ctx.Sender().ID) {
+		return ctx.Reply(errSuperadminOnly.Error())
+	}
+
+	user, _, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	loc := t.defaultLocation()
+	if group {
+		member, err := t.db.GetChatMember(ctx.Chat().ID, user.ID)
+		if err != nil {
+			return ctx.Reply(fmt.Sprintf("Бот еще не видел %s в этой группе", formatUser(user)))
+		}
+
+		return ctx.Reply("Участник: " + formatUser(user) + "\n" + formatMembership(member, loc))
+	}
+
+	members, err := t.db.GetUserChats(user.ID)
+	if err != nil {
+		zap.L().Error("Не удалось получить группы пользователя", zap.Error(err), zap.Int64("user_id", user.ID))
+		return ctx.Reply("Ошибка при получении групп пользователя")
+	}
+	if len(members) == 0 {
+		return ctx.Reply(fmt.Sprintf("Бот не знает групп, в которых состоит %s", formatUser(user)))
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Группы, в которых состоит %s:\n", formatUser(user)))
+	for _, member := range members {
+		title := fmt.Sprintf("%d", member.ChatID)
+		if member.Chat != nil && member.Chat.Title != "" {
+			title = fmt.Sprintf("%s (%d)", member.Chat.Title, member.ChatID)
+		}
+
+		joined := "дата вступления неизвестна"
+		if member.JoinedAt != nil {
+			joined = "вступил " + member.JoinedAt.In(loc).Format(modlogEntryLayout)
+		}
+
+		b.WriteString(fmt.Sprintf("\n%s - %s, %s", title, memberStatusName(member.Status), joined))
+	}
+
+	return ctx.Reply(b.String())
+}
+
+// formatMembership выводит участие пользователя в группе
+func formatMembership(member *database.ChatMember, loc *time.Location) string {
+	lines := []string{
+		"Статус: " + memberStatusName(member.Status),
+		"Впервые замечен: " + member.FirstSeenAt.In(loc).Format(modlogEntryLayout),
+		"Последняя активность: " + member.LastSeenAt.In(loc).Format(modlogEntryLayout),
+	}
+
+	joined := "неизвестно"
+	if member.JoinedAt != nil {
+		joined = member.JoinedAt.In(loc).Format(modlogEntryLayout)
+	}
+	lines = append(lines, "Вступил: "+joined)
+
+	if member.LeftAt != nil {
+		lines = append(lines, "Вышел: "+member.LeftAt.In(loc).Format(modlogEntryLayout))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// memberStatusName возвращает название статуса участника
+func memberStatusName(status string) string {
+	if name, ok := memberStatusNames[status]; ok {
+		return name
+	}
+
+	return status
+}
@@ -1,10 +1,11 @@
 package telegram
 
 import (
-	"app/dto"
+	"app/gateway/database"
+	"app/util"
+	"context"
+	"encoding/json"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -12,209 +13,305 @@ import (
 	tele "gopkg.in/telebot.v4"
 )
 
-// ModeratedGroup представляет группу, которая модерируется ботом
-type ModeratedGroup struct {
-	ChatID            int64
-	CloseTime         string // Формат: "HH:MM"
-	OpenTime          string // Формат: "HH:MM"
-	WhitelistedLinks  []string
-	WhitelistedUsers  []int64
-	EveningMessage    string
-	MorningMessage    string
-	ModerateLinks     bool
-	ModerateScheduled bool
+// Сколько хранятся настройки группы в кеше. Команды сбрасывают кеш сразу после изменения,
+// срок ограничивает устаревание, если сброс не удался
+const moderatedGroupTTL = 10 * time.Minute
+
+func moderatedGroupKey(chatID int64) string {
+	return fmt.Sprintf("moderated_group_settings:%d", chatID)
 }
 
 // Добавляем модели для сохранения в базе данных
 func (t *Telegram) setupModeration() {
 	// Регистрируем команды модерации
 	t.bot.Handle("/moderate", t.cmdModerate)
-	t.bot.Handle("/open", t.cmdSetOpenTime)
-	t.bot.Handle("/close", t.cmdSetCloseTime)
-	t.bot.Handle("/whitelist", t.cmdWhitelist)
+	t.bot.Handle("/unmoderate", t.cmdUnmoderate)
+	t.bot.Handle("/timezone", t.cmdSetTimeZone)
+	t.bot.Handle("/permissions", t.cmdPermissions)
+	t.bot.Handle("/link_policy", t.cmdLinkPolicy)
+	t.bot.Handle("/schedule", t.cmdSchedule)
+	t.bot.Handle("/schedule_add", t.cmdScheduleAdd)
+	t.bot.Handle("/schedule_remove", t.cmdScheduleRemove)
+	t.bot.Handle("/schedule_clear", t.cmdScheduleClear)
+	t.bot.Handle("/holiday", t.cmdHolidayAdd)
+	t.bot.Handle("/holiday_remove", t.cmdHolidayRemove)
 	t.bot.Handle("/evening_message", t.cmdSetEveningMessage)
 	t.bot.Handle("/morning_message", t.cmdSetMorningMessage)
+	t.bot.Handle("/flood", t.cmdFlood)
+	t.bot.Handle("/captcha", t.cmdCaptcha)
+	t.bot.Handle("/diagnose", t.cmdDiagnose)
+	t.setupGroupWhitelist()
+	t.setupGlobalWhitelist()
+	t.setupWarnings()
+	t.setupRestrictions()
+	t.setupStopwords()
+	t.setupAudit()
+	t.setupUsers()
+	t.setupMembership()
+	t.setupRoles()
+
+	// Проверка новых участников
+	t.bot.Handle(tele.OnUserJoined, t.onUserJoined)
+	t.bot.Handle(captchaButtonBtn, t.onCaptchaAnswer)
+
+	// Изменения прав участников сбрасывают кеш администраторов,
+	// изменения статуса самого бота еще и отмечают чат активным или неактивным
+	t.bot.Handle(tele.OnChatMember, t.onChatMemberUpdated)
+	t.bot.Handle(tele.OnMyChatMember, t.onMyChatMember)
+
+	// Перенос настроек при превращении группы в супергруппу
+	t.bot.Handle(tele.OnMigration, t.onMigration)
+
+	// Сообщения проверяет middleware moderation до обработчика, поэтому проверяются и команды.
+	// Телебот вызывает middleware только при наличии обработчика, для остальных типов сообщений
+	// регистрируется пустой. Пересланные сообщения приходят сюда же как текст или медиа
+	for _, endpoint := range moderatedEndpoints {
+		t.bot.Handle(endpoint, t.onGroupMessage)
+	}
+}
 
-	// Обработчик для всех сообщений (проверка ссылок)
-	t.bot.Handle(tele.OnText, t.moderateLinks)
-
-	// Запускаем планировщик для проверки времени открытия/закрытия чатов
-	go t.scheduleModeration()
+// Типы сообщений, которые проверяет модерация без отдельного обработчика
+var moderatedEndpoints = []string{
+	tele.OnText,
+	tele.OnEdited,
+	tele.OnPhoto,
+	tele.OnVideo,
+	tele.OnDocument,
+	tele.OnAnimation,
+	tele.OnAudio,
+	tele.OnVoice,
+	tele.OnSticker,
+	tele.OnVideoNote,
+	tele.OnContact,
+	tele.OnLocation,
+	tele.OnVenue,
+	tele.OnDice,
+	tele.OnGame,
 }
 
 // cmdModerate обрабатывает команду /moderate
 func (t *Telegram) cmdModerate(ctx tele.Context) error {
-	// Проверяем, что команда пришла из группы
-	if !ctx.Chat().IsGroup() {
-		return ctx.Reply("Эта команда доступна только в группах")
+	// Группа еще может быть не настроена, поэтому проверяются только чат и права отправителя
+	err := t.checkAdminChat(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
 	}
 
-	// Проверяем, что отправитель - администратор
-	sender := ctx.Sender()
-	admins, err := t.bot.AdminsOf(ctx.Chat())
+	// Без прав на удаление и блокировку модерация не сможет работать
+	missing, err := t.missingBotRights(ctx.Chat())
 	if err != nil {
-		zap.L().Error("Не удалось получить список администраторов", zap.Error(err))
-		return ctx.Reply("Ошибка при проверке прав администратора")
+		zap.L().Error("Не удалось проверить права бота", zap.Error(err))
+		return ctx.Reply("Ошибка при проверке прав бота")
 	}
+	if len(missing) > 0 {
+		return ctx.Reply("Боту не хватает прав: " + strings.Join(missing, ", ") +
+			".\nСделайте бота администратором с правами удалять сообщения и блокировать участников, затем повторите /moderate")
+	}
+	t.resetRightsAlerts(ctx.Chat().ID)
 
-	isAdmin := false
-	for _, admin := range admins {
-		if admin.User.ID == sender.ID {
-			isAdmin = true
-			break
+	// Если группа уже настраивалась, просто включаем модерацию обратно с прежними настройками
+	group, err := t.getModeratedGroup(ctx.Chat().ID)
+	if err == nil {
+		group.Disabled = false
+		err = t.saveModeratedGroup(group, "Disabled")
+		if err != nil {
+			zap.L().Error("Не удалось сохранить группу", zap.Error(err))
+			return ctx.Reply("Ошибка при настройке модерации")
 		}
-	}
 
-	if !isAdmin && sender.ID != dto.GlobalAdminID {
-		return ctx.Reply("Только администраторы могут использовать эту команду")
+		return ctx.Reply("Режим модерации снова включен для этой группы с прежними настройками")
 	}
 
-	// Создаем или обновляем запись о модерируемой группе
-	group := &ModeratedGroup{
+	// Создаем запись о модерируемой группе
+	group = &database.ModeratedGroup{
 		ChatID:            ctx.Chat().ID,
-		CloseTime:         "22:00",
-		OpenTime:          "09:00",
-		WhitelistedLinks:  []string{},
-		WhitelistedUsers:  []int64{},
+		WhitelistedLinks:  []database.WhitelistedLink{},
+		WhitelistedUsers:  []database.WhitelistedUser{},
+		ScheduleWindows:   database.DailyScheduleWindows("22:00", "09:00"),
 		EveningMessage:    "Чат закрыт до утра. Доброй ночи! 🌙",
 		MorningMessage:    "Доброе утро! Чат открыт. 🌞",
 		ModerateLinks:     true,
 		ModerateScheduled: true,
+		WarnExpireHours:   database.DefaultWarnExpireHours,
+		WarnLadder:        database.DefaultWarnLadder(),
+		FloodLimit:        10,
+		FloodWindow:       5,
+		FloodAction:       database.SanctionMute,
+		FloodDuration:     600,
+		CaptchaTimeout:    120,
+		CaptchaType:       captchaButton,
 	}
 
-	// Здесь нужно сохранить группу в базу данных
-	err = t.saveModeratedGroup(group)
+	err = t.db.CreateModeratedGroup(group)
 	if err != nil {
 		zap.L().Error("Не удалось сохранить группу", zap.Error(err))
 		return ctx.Reply("Ошибка при настройке модерации")
 	}
+	t.invalidateModeratedGroup(group.ChatID)
 
 	return ctx.Reply("Режим модерации включен для этой группы. По умолчанию:\n" +
-		"- Чат закрывается в 22:00\n" +
-		"- Чат открывается в 09:00\n" +
-		"- Модерация ссылок включена\n\n" +
+		"- Чат закрыт каждый день с 22:00 до 09:00\n" +
+		"- Модерация ссылок включена, за каждое удаление выдается предупреждение\n" +
+		"- Больше 10 сообщений за 5 секунд - мут на 10 минут\n" +
+		"- Предупреждения сгорают через 30 дней, 3 - мут на час, 5 - исключение, 7 - бан\n\n" +
 		"Настройки можно изменить командами:\n" +
-		"/close ЧЧ:ММ - время закрытия чата\n" +
-		"/open ЧЧ:ММ - время открытия чата\n" +
-		"/whitelist слово - добавить слово/ссылку в белый список")
+		"/schedule - расписание закрытия чата и команды для его изменения\n" +
+		"/timezone Europe/Moscow - часовой пояс расписания\n" +
+		"/permissions - права участников после открытия чата\n" +
+		"/link_policy - какие типы ссылок разрешены\n" +
+		"/allow_link запись, /links - белый список ссылок группы\n" +
+		"/mute, /ban, /kick, /unmute, /unban - наказания, например ответом: /mute 30m флуд\n" +
+		"/stopword_add, /stopwords - запрещенные слова и действия при их нахождении\n" +
+		"/flood - ограничение частоты сообщений\n" +
+		"/captcha - проверка новых участников, по умолчанию выключена\n" +
+		"/warn, /unwarn, /warns - предупреждения, /warn_settings - их настройки\n" +
+		"/trust, /untrust, /trusted - доверенные пользователи, их сообщения не проверяются\n" +
+		"/diagnose - проверка прав бота и настроек расписания\n" +
+		"/modlog - журнал действий модерации, можно отфильтровать по участнику и датам\n" +
+		"/names - прежние имена и юзернеймы участника\n" +
+		"/whois - когда участник вступил в группу и когда бот видел его последний раз\n" +
+		"/grant, /revoke, /roles - модераторы группы без прав администратора в телеграме\n" +
+		"/whitelist - глобальный белый список, только для владельцев и суперадминистраторов бота\n" +
+		"/unmoderate - выключить модерацию")
 }
 
-// cmdSetOpenTime устанавливает время открытия чата
-func (t *Telegram) cmdSetOpenTime(ctx tele.Context) error {
-	if !ctx.Chat().IsGroup() {
-		return ctx.Reply("Эта команда доступна только в группах")
-	}
-
-	// Проверяем права администратора
-	if !t.isAdmin(ctx.Chat(), ctx.Sender()) {
-		return ctx.Reply("Только администраторы могут использовать эту команду")
-	}
-
-	// Получаем аргументы команды
-	args := ctx.Args()
-	if len(args) != 1 {
-		return ctx.Reply("Пожалуйста, укажите время в формате ЧЧ:ММ, например: /open 09:00")
-	}
-
-	// Проверяем формат времени
-	timeStr := args[0]
-	if !t.isValidTimeFormat(timeStr) {
-		return ctx.Reply("Некорректный формат времени. Используйте формат ЧЧ:ММ, например: 09:00")
+// cmdUnmoderate выключает модерацию в группе. Настройки сохраняются,
+// но группа пропадает из планировщика и ее сообщения больше не проверяются
+func (t *Telegram) cmdUnmoderate(ctx tele.Context) error {
+	err := t.checkAdminChat(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
 	}
 
-	// Получаем текущие настройки группы
 	group, err := t.getModeratedGroup(ctx.Chat().ID)
-	if err != nil {
-		return ctx.Reply("Эта группа не настроена для модерации. Используйте сначала команду /moderate")
+	if err != nil || group.Disabled {
+		return ctx.Reply("Модерация в этой группе и так выключена")
 	}
 
-	// Обновляем время открытия
-	group.OpenTime = timeStr
-	err = t.saveModeratedGroup(group)
+	group.Disabled = true
+	err = t.saveModeratedGroup(group, "Disabled")
 	if err != nil {
 		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
 		return ctx.Reply("Ошибка при обновлении настроек")
 	}
 
-	return ctx.Reply(fmt.Sprintf("Время открытия чата установлено на %s", timeStr))
-}
-
-// cmdSetCloseTime устанавливает время закрытия чата
-func (t *Telegram) cmdSetCloseTime(ctx tele.Context) error {
-	if !ctx.Chat().IsGroup() {
-		return ctx.Reply("Эта команда доступна только в группах")
+	// Планировщик больше не откроет чат, поэтому открываем его сразу, если он закрыт по расписанию
+	if group.ScheduleState == database.ScheduleStateClosed {
+		err = t.openChat(group, false)
+		if err != nil {
+			zap.L().Error("Не удалось открыть чат", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+		}
 	}
 
-	// Проверяем права администратора
-	if !t.isAdmin(ctx.Chat(), ctx.Sender()) {
-		return ctx.Reply("Только администраторы могут использовать эту команду")
+	return ctx.Reply("Модерация выключена. Включить снова можно командой /moderate")
+}
+
+// cmdSetTimeZone устанавливает часовой пояс, в котором считается расписание группы
+func (t *Telegram) cmdSetTimeZone(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
 	}
 
-	// Получаем аргументы команды
+	// Без аргументов показываем текущий пояс
 	args := ctx.Args()
-	if len(args) != 1 {
-		return ctx.Reply("Пожалуйста, укажите время в формате ЧЧ:ММ, например: /close 22:00")
+	if len(args) == 0 {
+		loc := t.groupLocation(group)
+		return ctx.Reply(fmt.Sprintf("Часовой пояс группы: %s, сейчас %s.\n"+
+			"Изменить: /timezone Europe/Moscow", loc, time.Now().In(loc).Format("15:04")))
 	}
-
-	// Проверяем формат времени
-	timeStr := args[0]
-	if !t.isValidTimeFormat(timeStr) {
-		return ctx.Reply("Некорректный формат времени. Используйте формат ЧЧ:ММ, например: 22:00")
+	if len(args) != 1 {
+		return ctx.Reply("Пожалуйста, укажите часовой пояс, например: /timezone Europe/Moscow")
 	}
 
-	// Получаем текущие настройки группы
-	group, err := t.getModeratedGroup(ctx.Chat().ID)
-	if err != nil {
-		return ctx.Reply("Эта группа не настроена для модерации. Используйте сначала команду /moderate")
+	loc, err := time.LoadLocation(args[0])
+	if err != nil || args[0] == "Local" {
+		return ctx.Reply("Неизвестный часовой пояс. Используйте название из базы IANA, например: Europe/Moscow, Asia/Novosibirsk, Asia/Vladivostok")
 	}
 
-	// Обновляем время закрытия
-	group.CloseTime = timeStr
-	err = t.saveModeratedGroup(group)
+	group.TimeZone = loc.String()
+	err = t.saveModeratedGroup(group, "TimeZone")
 	if err != nil {
 		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
 		return ctx.Reply("Ошибка при обновлении настроек")
 	}
 
-	return ctx.Reply(fmt.Sprintf("Время закрытия чата установлено на %s", timeStr))
+	state := "открыт"
+	if t.isClosedAt(group, time.Now()) {
+		state = "закрыт"
+	}
+
+	return ctx.Reply(fmt.Sprintf("Часовой пояс установлен: %s, сейчас %s. По расписанию чат сейчас %s",
+		group.TimeZone, time.Now().In(loc).Format("15:04"), state))
 }
 
-// cmdWhitelist обрабатывает команду /whitelist для добавления слов/ссылок в белый список
-func (t *Telegram) cmdWhitelist(ctx tele.Context) error {
-	// Эта команда доступна только в личке и только для глобального админа
-	if !ctx.Chat().IsPrivate() {
-		return ctx.Reply("Эта команда доступна только в личной переписке с ботом")
+// cmdLinkPolicy показывает и меняет, какие типы ссылок разрешены в группе
+func (t *Telegram) cmdLinkPolicy(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		var b strings.Builder
+		b.WriteString("Политика ссылок в группе:\n\n")
+		for _, item := range linkTypes {
+			state := "удаляются"
+			if isLinkTypeAllowed(group.AllowedLinkTypes, item.Type) {
+				state = "разрешены"
+			}
+			b.WriteString(fmt.Sprintf("%s - %s: %s\n", item.Type, item.Description, state))
+		}
+		b.WriteString("\nИзменить: /link_policy тип allow|block, например: /link_policy mention allow")
+
+		return ctx.Reply(b.String())
 	}
 
-	if ctx.Sender().ID != dto.GlobalAdminID {
-		return ctx.Reply("Эта команда доступна только для главного администратора")
+	if len(args) != 2 || (args[1] != "allow" && args[1] != "block") {
+		return ctx.Reply("Используйте формат /link_policy тип allow|block, например: /link_policy mention allow")
 	}
 
-	args := ctx.Args()
-	if len(args) < 1 {
-		return ctx.Reply("Пожалуйста, укажите слово или регулярное выражение для добавления в белый список")
+	known := false
+	for _, item := range linkTypes {
+		if item.Type == args[0] {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return ctx.Reply("Неизвестный тип ссылок. Список типов можно посмотреть командой /link_policy")
 	}
 
-	// Добавляем слово в глобальный белый список
-	whitelist := strings.Join(args, " ")
-	err := t.addToGlobalWhitelist(whitelist)
+	allowed := make([]string, 0, len(group.AllowedLinkTypes)+1)
+	for _, item := range group.AllowedLinkTypes {
+		if item != args[0] {
+			allowed = append(allowed, item)
+		}
+	}
+	if args[1] == "allow" {
+		allowed = append(allowed, args[0])
+	}
+	group.AllowedLinkTypes = allowed
+
+	err := t.saveModeratedGroup(group, "AllowedLinkTypes")
 	if err != nil {
-		zap.L().Error("Не удалось добавить в белый список", zap.Error(err))
-		return ctx.Reply("Ошибка при добавлении в белый список")
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+
+	if args[1] == "allow" {
+		return ctx.Reply(fmt.Sprintf("Ссылки типа %s теперь разрешены", args[0]))
 	}
 
-	return ctx.Reply(fmt.Sprintf("'%s' добавлено в глобальный белый список", whitelist))
+	return ctx.Reply(fmt.Sprintf("Ссылки типа %s теперь удаляются", args[0]))
 }
 
 // cmdSetEveningMessage устанавливает сообщение, которое отправляется при закрытии чата
 func (t *Telegram) cmdSetEveningMessage(ctx tele.Context) error {
-	if !ctx.Chat().IsGroup() {
-		return ctx.Reply("Эта команда доступна только в группах")
-	}
-
-	// Проверяем права администратора
-	if !t.isAdmin(ctx.Chat(), ctx.Sender()) {
-		return ctx.Reply("Только администраторы могут использовать эту команду")
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
 	}
 
 	// Получаем текст сообщения
@@ -223,15 +320,9 @@ func (t *Telegram) cmdSetEveningMessage(ctx tele.Context) error {
 		return ctx.Reply("Пожалуйста, укажите текст вечернего сообщения")
 	}
 
-	// Получаем текущие настройки группы
-	group, err := t.getModeratedGroup(ctx.Chat().ID)
-	if err != nil {
-		return ctx.Reply("Эта группа не настроена для модерации. Используйте сначала команду /moderate")
-	}
-
 	// Обновляем сообщение
 	group.EveningMessage = message
-	err = t.saveModeratedGroup(group)
+	err := t.saveModeratedGroup(group, "EveningMessage")
 	if err != nil {
 		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
 		return ctx.Reply("Ошибка при обновлении настроек")
@@ -242,13 +333,9 @@ func (t *Telegram) cmdSetEveningMessage(ctx tele.Context) error {
 
 // cmdSetMorningMessage устанавливает сообщение, которое отправляется при открытии чата
 func (t *Telegram) cmdSetMorningMessage(ctx tele.Context) error {
-	if !ctx.Chat().IsGroup() {
-		return ctx.Reply("Эта команда доступна только в группах")
-	}
-
-	// Проверяем права администратора
-	if !t.isAdmin(ctx.Chat(), ctx.Sender()) {
-		return ctx.Reply("Только администраторы могут использовать эту команду")
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
 	}
 
 	// Получаем текст сообщения
@@ -257,15 +344,9 @@ func (t *Telegram) cmdSetMorningMessage(ctx tele.Context) error {
 		return ctx.Reply("Пожалуйста, укажите текст утреннего сообщения")
 	}
 
-	// Получаем текущие настройки группы
-	group, err := t.getModeratedGroup(ctx.Chat().ID)
-	if err != nil {
-		return ctx.Reply("Эта группа не настроена для модерации. Используйте сначала команду /moderate")
-	}
-
 	// Обновляем сообщение
 	group.MorningMessage = message
-	err = t.saveModeratedGroup(group)
+	err := t.saveModeratedGroup(group, "MorningMessage")
 	if err != nil {
 		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
 		return ctx.Reply("Ошибка при обновлении настроек")
@@ -274,72 +355,269 @@ func (t *Telegram) cmdSetMorningMessage(ctx tele.Context) error {
 	return ctx.Reply("Утреннее сообщение обновлено")
 }
 
-// moderateLinks обрабатывает все текстовые сообщения для модерации ссылок
-func (t *Telegram) moderateLinks(ctx tele.Context) error {
+// moderation middleware, которое проверяет каждое сообщение в группе до его обработчика,
+// в том числе команды. Удаленное сообщение дальше не обрабатывается
+func (t *Telegram) moderation(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(ctx tele.Context) error {
+		if ctx.Callback() == nil && t.moderateMessage(ctx) {
+			return nil
+		}
+
+		return next(ctx)
+	}
+}
+
+// onGroupMessage обработчик сообщений без команды. Проверки уже выполнил middleware moderation
+func (t *Telegram) onGroupMessage(_ tele.Context) error {
+	return nil
+}
+
+// catchPolls проверяет сообщения с опросами: телебот не передает их ни одному обработчику,
+// поэтому они проходят те же middleware прямо из поллера. Опросы приходят редко, и проверка
+// выполняется в горутине поллера, а паника в ней не останавливает получение обновлений
+func (t *Telegram) catchPolls(update *tele.Update) bool {
+	if update.Message == nil || update.Message.Poll == nil {
+		return true
+	}
+	defer util.PreventPanic("Паника при обработке опроса")
+
+	handler := t.trackUsers(t.trackMembership(t.moderation(t.onGroupMessage)))
+	err := handler(t.bot.NewContext(*update))
+	if err != nil {
+		zap.L().Error("Не удалось обработать опрос", zap.Error(err), zap.Int64("chat_id", update.Message.Chat.ID))
+	}
+
+	return true
+}
+
+// isServiceMessage проверяет, что сообщение служебное: вступление, выход, закрепление и тому подобное
+func isServiceMessage(msg *tele.Message) bool {
+	return msg.IsService() || msg.PinnedMessage != nil || msg.TopicCreated != nil
+}
+
+func linkedChatKey(chatID int64) string {
+	return fmt.Sprintf("linked_chat:%d", chatID)
+}
+
+// Сколько хранится ID канала, связанного с группой
+const linkedChatTTL = time.Hour
+
+// isOwnSenderChat проверяет, что сообщение отправлено от имени самой группы (анонимный администратор)
+// или связанного с ней канала. Такие сообщения не модерируются
+func (t *Telegram) isOwnSenderChat(msg *tele.Message) bool {
+	if msg.SenderChat == nil {
+		return false
+	}
+	if msg.SenderChat.ID == msg.Chat.ID || msg.AutomaticForward {
+		return true
+	}
+
+	key := linkedChatKey(msg.Chat.ID)
+	linked, err := t.redis.GetInt64(key)
+	if err != nil {
+		chat, err := t.bot.ChatByID(msg.Chat.ID)
+		if err != nil {
+			zap.L().Error("Не удалось получить связанный канал", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+			return false
+		}
+		linked = chat.LinkedChatID
+
+		err = t.redis.SetWithTTL(key, linked, linkedChatTTL)
+		if err != nil {
+			zap.L().Error("Не удалось сохранить связанный канал", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+		}
+	}
+
+	return linked != 0 && msg.SenderChat.ID == linked
+}
+
+// moderateMessage общий конвейер модерации для сообщений в группах: новых и отредактированных,
+// текстовых, медиа и команд, в том числе пересланных. Возвращает true, если сообщение удалено
+func (t *Telegram) moderateMessage(ctx tele.Context) bool {
+	msg := ctx.Message()
+	if msg == nil || ctx.Sender() == nil || isServiceMessage(msg) {
+		return false
+	}
+
 	// Обрабатываем только сообщения в группах
-	if !ctx.Chat().IsGroup() {
-		return nil
+	if !isGroupChat(ctx.Chat()) {
+		return false
 	}
 
 	// Проверяем, включена ли модерация в этой группе
-	group, err := t.getModeratedGroup(ctx.Chat().ID)
-	if err != nil || !group.ModerateLinks {
-		return nil
+	group, err := t.cachedModeratedGroup(ctx.Chat().ID)
+	if err != nil || group.Disabled {
+		return false
 	}
 
-	// Если отправитель - администратор, не модерируем
-	if t.isAdmin(ctx.Chat(), ctx.Sender()) {
-		return nil
+	// Если часть альбома уже удалена, остальные части удаляем вслед за ней
+	if t.trackAlbum(msg) {
+		return true
+	}
+
+	// Анонимные администраторы и связанный канал пишут от имени чата, отправитель у них
+	// служебный бот, и наказание досталось бы ему
+	if t.isOwnSenderChat(msg) {
+		return false
+	}
+
+	// Если отправитель - администратор, не модерируем. Если список администраторов недоступен,
+	// сообщение тоже пропускаем, чтобы не наказать администратора по ошибке
+	isAdmin, err := t.auth.checkAdmin(ctx.Chat(), ctx.Sender())
+	if err != nil {
+		zap.L().Warn("Не удалось проверить администратора, сообщение не проверяется",
+			zap.Error(err),
+			zap.Int64("chat_id", ctx.Chat().ID))
+		return false
+	}
+	if isAdmin {
+		return false
 	}
 
 	// Если пользователь в белом списке, не модерируем
 	if t.isUserWhitelisted(ctx.Sender().ID, group) {
-		return nil
+		return false
+	}
+
+	// Флуд проверяем первым: сообщение сверх лимита удаляется независимо от содержимого
+	if t.moderateFlood(ctx, group) {
+		return true
+	}
+
+	// Запрещенные слова и ссылки проверяются независимо, удаленное сообщение дальше не проверяем
+	if t.moderateStopwords(ctx, group) {
+		return true
+	}
+
+	return t.moderateLinks(ctx, group)
+}
+
+// moderateLinks удаляет сообщение, если в нем есть запрещенные ссылки. Возвращает true, если сообщение удалено
+func (t *Telegram) moderateLinks(ctx tele.Context, group *database.ModeratedGroup) bool {
+	if !group.ModerateLinks {
+		return false
 	}
 
 	// Проверяем наличие ссылок в сообщении
-	text := ctx.Text()
-	if t.containsBlockedLink(text, group) {
-		// Удаляем сообщение
-		err := ctx.Delete()
-		if err != nil {
-			zap.L().Error("Не удалось удалить сообщение", zap.Error(err))
+	finding, found := t.containsBlockedLink(ctx.Message(), group)
+	if !found {
+		return false
+	}
+
+	zap.L().Debug("Найдена запрещенная ссылка",
+		zap.Int64("chat_id", ctx.Chat().ID),
+		zap.String("type", finding.Type),
+		zap.String("value", finding.Value))
+
+	// Удаляем сообщение вместе с альбомом, если оно в него входит
+	err := t.deleteMessage(ctx.Message())
+	if err != nil {
+		zap.L().Error("Не удалось удалить сообщение", zap.Error(err))
+		return false
+	}
+
+	// Каждое удаление считается предупреждением, альбом - одним
+	if !t.firstAlbumViolation(ctx.Message()) {
+		return true
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   ctx.Chat().ID,
+		TargetID: ctx.Sender().ID,
+		Action:   actionDelete,
+		Rule:     fmt.Sprintf("ссылка %s: %s", finding.Type, finding.Value),
+		Excerpt:  messageExcerpt(ctx.Message()),
+	})
+
+	notice := "Ваше сообщение было удалено, так как оно содержит ссылки. Если вы считаете, что это ошибка, обратитесь к администраторам группы."
+	result, err := t.warnUser(group, ctx.Chat(), ctx.Sender(), 0, "ссылка: "+finding.Type)
+	if err != nil {
+		zap.L().Error("Не удалось выдать предупреждение", zap.Error(err))
+	} else {
+		notice += "\n\n" + result.String()
+	}
+
+	// Уведомляем пользователя (в личку)
+	_, _ = t.bot.Send(&tele.User{ID: ctx.Sender().ID}, notice)
+
+	return true
+}
+
+// Сколько сверок расписания подряд может завершиться ошибкой, прежде чем планировщик остановит бота.
+// Единичные сбои базы переживаются повтором через минуту, а о долгом сбое узнает errgroup
+const scheduleMaxFailures = 30
+
+// scheduleModeration запускает планировщик для проверки времени открытия/закрытия чатов.
+// Сразу при старте сверяет состояние чатов с расписанием, чтобы наверстать время простоя.
+// Блокируется до отмены контекста. Ошибка сверки, в том числе первой, повторяется на следующем тике,
+// а после scheduleMaxFailures ошибок подряд возвращается наружу
+func (t *Telegram) scheduleModeration(ctx context.Context) error {
+	failures := 0
+	checkSchedule := func() error {
+		err := t.checkGroupsSchedule()
+		if err == nil {
+			failures = 0
 			return nil
 		}
 
-		// Уведомляем пользователя (в личку)
-		t.bot.Send(&tele.User{ID: ctx.Sender().ID}, "Ваше сообщение было удалено, так как оно содержит ссылки. Если вы считаете, что это ошибка, обратитесь к администраторам группы.")
+		failures++
+		if failures >= scheduleMaxFailures {
+			return fmt.Errorf("moderation scheduler: %d failed checks in a row: %w", failures, err)
+		}
+		zap.L().Error("Не удалось сверить расписание групп, повтор через минуту", zap.Error(err), zap.Int("failures", failures))
 
 		return nil
 	}
 
-	return nil
-}
+	err := checkSchedule()
+	if err != nil {
+		return err
+	}
 
-// scheduleModeration запускает планировщик для проверки времени открытия/закрытия чатов
-func (t *Telegram) scheduleModeration() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
+	// Сроки проверки новых участников короче минуты, поэтому проверяются отдельно и чаще
+	captchaTicker := time.NewTicker(5 * time.Second)
+	defer captchaTicker.Stop()
+
+	usersTicker := time.NewTicker(usersFlushInterval)
+	defer usersTicker.Stop()
+
 	for {
 		select {
+		case <-ctx.Done():
+			t.flushUsers()
+			zap.L().Info("Планировщик модерации остановлен")
+			return nil
 		case <-ticker.C:
-			t.checkGroupsSchedule()
+			err := checkSchedule()
+			if err != nil {
+				t.flushUsers()
+				return err
+			}
+		case <-captchaTicker.C:
+			t.expireCaptchas()
+		case <-usersTicker.C:
+			t.flushUsers()
+		case <-t.users.full:
+			t.flushUsers()
 		}
 	}
 }
 
-// checkGroupsSchedule проверяет расписание для всех модерируемых групп
-func (t *Telegram) checkGroupsSchedule() {
-	// Получаем текущее время
+// checkGroupsSchedule сверяет состояние всех модерируемых групп с расписанием.
+// Для каждой группы вычисляется, открыт или закрыт должен быть чат сейчас, и если последнее
+// примененное ботом состояние другое, выполняется недостающий переход. Так пропущенные
+// тики и простой бота не оставляют чат открытым на всю ночь
+func (t *Telegram) checkGroupsSchedule() error {
 	now := time.Now()
-	currentTimeStr := now.Format("15:04")
 
 	// Получаем все модерируемые группы
 	groups, err := t.getAllModeratedGroups()
 	if err != nil {
 		zap.L().Error("Не удалось получить список модерируемых групп", zap.Error(err))
-		return
+		return err
 	}
 
 	for _, group := range groups {
@@ -347,154 +625,212 @@ func (t *Telegram) checkGroupsSchedule() {
 			continue
 		}
 
-		// Проверяем, совпадает ли текущее время с временем открытия/закрытия
-		if currentTimeStr == group.OpenTime {
-			t.openChat(group)
-		} else if currentTimeStr == group.CloseTime {
-			t.closeChat(group)
+		expected := database.ScheduleStateOpen
+		if t.isClosedAt(group, now) {
+			expected = database.ScheduleStateClosed
+		}
+		if group.ScheduleState == expected {
+			continue
+		}
+
+		// Несколько копий бота могут работать с одним редисом, переход должен выполнить только одна
+		locked, err := t.redis.SetNX(fmt.Sprintf("lock:schedule:%d", group.ChatID), expected, 30*time.Second)
+		if err != nil {
+			zap.L().Error("Не удалось взять блокировку расписания", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		// Если состояние еще ни разу не применялось, не знаем, что видели участники,
+		// поэтому выставляем права молча, без утреннего/вечернего сообщения
+		notify := group.ScheduleState != ""
+
+		if expected == database.ScheduleStateClosed {
+			err = t.closeChat(group, notify)
+		} else {
+			err = t.openChat(group, notify)
 		}
+		if err != nil {
+			zap.L().Error("Не удалось применить расписание", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+			_ = t.reportRightsError(group.ChatID, rightsProblemSchedule, err)
+		}
+		t.saveSchedulerError(group.ChatID, err)
 	}
+
+	return nil
 }
 
-// openChat открывает чат для отправки сообщений
-func (t *Telegram) openChat(group *ModeratedGroup) {
+// openChat открывает чат для отправки сообщений и запоминает примененное состояние.
+// Утреннее сообщение отправляется только после того, как состояние сохранено, чтобы не повторить его
+func (t *Telegram) openChat(group *database.ModeratedGroup, notify bool) error {
 	chat := &tele.Chat{ID: group.ChatID}
 
-	// Устанавливаем разрешения для отправки сообщений
-	permissions := tele.ChatPermissions{
-		CanSendMessages:       true,
-		CanSendMediaMessages:  true,
-		CanSendPolls:          true,
-		CanSendOtherMessages:  true,
-		CanAddWebPagePreviews: true,
-		CanChangeInfo:         false,
-		CanInviteUsers:        true,
-		CanPinMessages:        false,
-	}
+	// Восстанавливаем права участников группы
+	permissions := rightsFromPermissions(groupOpenPermissions(group))
 
 	err := t.bot.SetGroupPermissions(chat, permissions)
 	if err != nil {
-		zap.L().Error("Не удалось открыть чат", zap.Error(err), zap.Int64("chat_id", group.ChatID))
-		return
+		return fmt.Errorf("open chat: %w", err)
+	}
+
+	err = t.db.SetModeratedGroupState(group.ChatID, database.ScheduleStateOpen)
+	if err != nil {
+		return fmt.Errorf("save schedule state: %w", err)
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	group.ScheduleState = database.ScheduleStateOpen
+
+	zap.L().Info("Чат открыт", zap.Int64("chat_id", group.ChatID))
+
+	if !notify {
+		return nil
 	}
 
 	// Отправляем утреннее сообщение
-	_, err = t.bot.Send(chat, group.MorningMessage)
+	_, err = t.bot.Send(chat, t.withNextChange(group, group.MorningMessage, "Чат закроется"))
 	if err != nil {
 		zap.L().Error("Не удалось отправить утреннее сообщение", zap.Error(err), zap.Int64("chat_id", group.ChatID))
 	}
 
-	zap.L().Info("Чат открыт", zap.Int64("chat_id", group.ChatID))
+	return nil
 }
 
-// closeChat закрывает чат для отправки сообщений
-func (t *Telegram) closeChat(group *ModeratedGroup) {
+// closeChat закрывает чат для отправки сообщений и запоминает примененное состояние.
+// Вечернее сообщение отправляется только после того, как состояние сохранено, чтобы не повторить его
+func (t *Telegram) closeChat(group *database.ModeratedGroup, notify bool) error {
 	chat := &tele.Chat{ID: group.ChatID}
 
-	// Устанавливаем запрет на отправку сообщений
-	permissions := tele.ChatPermissions{
-		CanSendMessages:       false,
-		CanSendMediaMessages:  false,
-		CanSendPolls:          false,
-		CanSendOtherMessages:  false,
-		CanAddWebPagePreviews: false,
-		CanChangeInfo:         false,
-		CanInviteUsers:        false,
-		CanPinMessages:        false,
-	}
+	// Запоминаем текущие права участников, чтобы вернуть их при открытии
+	t.snapshotPermissions(group)
+
+	// Устанавливаем запрет на отправку сообщений, остальные текущие права группы не трогаем
+	current := groupOpenPermissions(group)
+	if group.SnapshotPermissions != nil {
+		current = *group.SnapshotPermissions
+	}
+	permissions := rightsFromPermissions(current)
+	permissions.CanSendMessages = false
+	permissions.CanSendAudios = false
+	permissions.CanSendDocuments = false
+	permissions.CanSendPhotos = false
+	permissions.CanSendVideos = false
+	permissions.CanSendVideoNotes = false
+	permissions.CanSendVoiceNotes = false
+	permissions.CanSendPolls = false
+	permissions.CanSendOther = false
+	permissions.CanAddPreviews = false
 
 	err := t.bot.SetGroupPermissions(chat, permissions)
 	if err != nil {
-		zap.L().Error("Не удалось закрыть чат", zap.Error(err), zap.Int64("chat_id", group.ChatID))
-		return
+		return fmt.Errorf("close chat: %w", err)
+	}
+
+	err = t.db.SetModeratedGroupState(group.ChatID, database.ScheduleStateClosed)
+	if err != nil {
+		return fmt.Errorf("save schedule state: %w", err)
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	group.ScheduleState = database.ScheduleStateClosed
+
+	zap.L().Info("Чат закрыт", zap.Int64("chat_id", group.ChatID))
+
+	if !notify {
+		return nil
 	}
 
 	// Отправляем вечернее сообщение
-	_, err = t.bot.Send(chat, group.EveningMessage)
+	_, err = t.bot.Send(chat, t.withNextChange(group, group.EveningMessage, "Чат откроется"))
 	if err != nil {
 		zap.L().Error("Не удалось отправить вечернее сообщение", zap.Error(err), zap.Int64("chat_id", group.ChatID))
 	}
 
-	zap.L().Info("Чат закрыт", zap.Int64("chat_id", group.ChatID))
+	return nil
 }
 
 // Вспомогательные функции
 
-// isAdmin проверяет, является ли пользователь администратором чата
-func (t *Telegram) isAdmin(chat *tele.Chat, user *tele.User) bool {
-	if user.ID == dto.GlobalAdminID {
-		return true
+// isGroupChat проверяет, что чат - группа. Модерация работает и в обычных группах,
+// и в супергруппах, включая супергруппы с темами (форумы)
+func isGroupChat(chat *tele.Chat) bool {
+	return chat.Type == tele.ChatGroup || chat.Type == tele.ChatSuperGroup
+}
+
+// onMigration переносит настройки группы на новый ID, когда телеграм превращает группу в супергруппу
+func (t *Telegram) onMigration(ctx tele.Context) error {
+	from, to := ctx.Migration()
+	if from == 0 || to == 0 {
+		return nil
 	}
 
-	admins, err := t.bot.AdminsOf(chat)
+	err := t.db.MigrateChatID(from, to)
 	if err != nil {
-		zap.L().Error("Не удалось получить список администраторов", zap.Error(err))
-		return false
+		zap.L().Error("Не удалось перенести настройки группы", zap.Error(err), zap.Int64("from", from), zap.Int64("to", to))
+		return nil
 	}
+	t.invalidateModeratedGroup(from)
+	t.invalidateModeratedGroup(to)
 
-	for _, admin := range admins {
-		if admin.User.ID == user.ID {
-			return true
-		}
+	zap.L().Info("Группа стала супергруппой, настройки перенесены", zap.Int64("from", from), zap.Int64("to", to))
+
+	// Модераторы группы тоже перенесены, их роли в кеше указывают на старый чат
+	err = t.auth.invalidateChat(to)
+	if err != nil {
+		zap.L().Error("Не удалось сбросить кеш ролей", zap.Error(err), zap.Int64("chat_id", to))
 	}
 
-	return false
+	return nil
 }
 
-// isValidTimeFormat проверяет корректность формата времени
-func (t *Telegram) isValidTimeFormat(timeStr string) bool {
-	re := regexp.MustCompile(`^([01]?[0-9]|2[0-3]):([0-5][0-9])$`)
-	return re.MatchString(timeStr)
-}
+// withNextChange дописывает к сообщению время следующего открытия или закрытия чата по расписанию
+func (t *Telegram) withNextChange(group *database.ModeratedGroup, message string, prefix string) string {
+	next, ok := t.nextScheduleChange(group, time.Now())
+	if !ok {
+		return message
+	}
 
-// containsBlockedLink проверяет, содержит ли текст заблокированные ссылки
-func (t *Telegram) containsBlockedLink(text string, group *ModeratedGroup) bool {
-	// Регулярные выражения для проверки различных типов ссылок
-	urlRe := regexp.MustCompile(`https?://\S+`)
-	tMeRe := regexp.MustCompile(`t\.me/\S+`)
-	atMentionRe := regexp.MustCompile(`@\w+`)
+	return fmt.Sprintf("%s\n\n%s %s в %s", message, prefix, weekdayNames[next.Weekday()], next.Format("15:04"))
+}
 
+// containsBlockedLink ищет в сообщении ссылку, которую политика группы и белые списки не разрешают
+func (t *Telegram) containsBlockedLink(msg *tele.Message, group *database.ModeratedGroup) (linkFinding, bool) {
 	// Получаем глобальный белый список
 	globalWhitelist, err := t.getGlobalWhitelist()
 	if err != nil {
 		zap.L().Error("Не удалось получить глобальный белый список", zap.Error(err))
-		globalWhitelist = []string{}
+		globalWhitelist = []whitelistEntry{}
 	}
 
 	// Объединяем глобальный и локальный белые списки
-	whitelist := append(globalWhitelist, group.WhitelistedLinks...)
+	whitelist := append(globalWhitelist, groupWhitelist(group)...)
 
-	// Находим все совпадения
-	urls := urlRe.FindAllString(text, -1)
-	tMeLinks := tMeRe.FindAllString(text, -1)
-	mentions := atMentionRe.FindAllString(text, -1)
-
-	// Объединяем все найденные ссылки
-	allLinks := append(urls, tMeLinks...)
-	allLinks = append(allLinks, mentions...)
+	// Проверяем каждую найденную ссылку
+	for _, finding := range findLinks(msg) {
+		if isLinkTypeAllowed(group.AllowedLinkTypes, finding.Type) {
+			continue
+		}
 
-	// Проверяем каждую ссылку
-	for _, link := range allLinks {
 		isWhitelisted := false
 		for _, allowed := range whitelist {
-			if strings.Contains(strings.ToLower(link), strings.ToLower(allowed)) {
+			if allowed.matches(finding) {
 				isWhitelisted = true
 				break
 			}
 		}
 
 		if !isWhitelisted {
-			return true
+			return finding, true
 		}
 	}
 
-	return false
+	return linkFinding{}, false
 }
 
 // isUserWhitelisted проверяет, находится ли пользователь в белом списке
-func (t *Telegram) isUserWhitelisted(userID int64, group *ModeratedGroup) bool {
-	for _, id := range group.WhitelistedUsers {
-		if id == userID {
+func (t *Telegram) isUserWhitelisted(userID int64, group *database.ModeratedGroup) bool {
+	for _, user := range group.WhitelistedUsers {
+		if user.UserID == userID {
 			return true
 		}
 	}
@@ -503,191 +839,74 @@ func (t *Telegram) isUserWhitelisted(userID int64, group *ModeratedGroup) bool {
 
 // Методы работы с базой данных для модерации
 
-// saveModeratedGroup сохраняет настройки модерируемой группы в базу данных
-func (t *Telegram) saveModeratedGroup(group *ModeratedGroup) error {
-	// Здесь должен быть код для сохранения в базу данных
-	// В примере используем Redis для хранения данных
-
-	key := fmt.Sprintf("moderated_group:%d", group.ChatID)
-
-	// Сериализуем данные в формат для хранения
-	whitelistedLinks := strings.Join(group.WhitelistedLinks, ",")
-
-	var whitelistedUsersStr []string
-	for _, id := range group.WhitelistedUsers {
-		whitelistedUsersStr = append(whitelistedUsersStr, strconv.FormatInt(id, 10))
-	}
-	whitelistedUsers := strings.Join(whitelistedUsersStr, ",")
-
-	// Сохраняем поля группы
-	err := t.redis.Set(key+":close_time", group.CloseTime)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":open_time", group.OpenTime)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":whitelisted_links", whitelistedLinks)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":whitelisted_users", whitelistedUsers)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":evening_message", group.EveningMessage)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":morning_message", group.MorningMessage)
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":moderate_links", strconv.FormatBool(group.ModerateLinks))
-	if err != nil {
-		return err
-	}
-
-	err = t.redis.Set(key+":moderate_scheduled", strconv.FormatBool(group.ModerateScheduled))
+// saveModeratedGroup сохраняет в базу данных измененные командой поля настроек группы.
+// У белых списков, расписания и запрещенных слов свои методы базы
+func (t *Telegram) saveModeratedGroup(group *database.ModeratedGroup, columns ...string) error {
+	err := t.db.SaveModeratedGroup(group, columns...)
 	if err != nil {
 		return err
 	}
 
+	t.invalidateModeratedGroup(group.ChatID)
 	return nil
 }
 
 // getModeratedGroup получает настройки модерируемой группы из базы данных
-func (t *Telegram) getModeratedGroup(chatID int64) (*ModeratedGroup, error) {
-	key := fmt.Sprintf("moderated_group:%d", chatID)
-
-	// Проверяем существование записи
-	if !t.redis.Has(key + ":close_time") {
-		return nil, fmt.Errorf("group not found")
-	}
-
-	closeTime, err := t.redis.GetString(key + ":close_time")
-	if err != nil {
-		return nil, err
-	}
-
-	openTime, err := t.redis.GetString(key + ":open_time")
-	if err != nil {
-		return nil, err
-	}
+func (t *Telegram) getModeratedGroup(chatID int64) (*database.ModeratedGroup, error) {
+	return t.db.GetModeratedGroup(chatID)
+}
 
-	whitelistedLinksStr, err := t.redis.GetString(key + ":whitelisted_links")
-	if err != nil {
-		return nil, err
+// cachedModeratedGroup возвращает настройки группы для проверки сообщений. Они читаются на каждом
+// сообщении, поэтому хранятся в редисе; группа без модерации тоже кешируется, как nil
+func (t *Telegram) cachedModeratedGroup(chatID int64) (*database.ModeratedGroup, error) {
+	key := moderatedGroupKey(chatID)
+
+	data, err := t.redis.GetBytes(key)
+	if err == nil {
+		var group *database.ModeratedGroup
+		err = json.Unmarshal(data, &group)
+		if err == nil {
+			if group == nil {
+				return nil, errNotModerated
+			}
+			return group, nil
+		}
+		zap.L().Warn("Некорректные настройки группы в редисе", zap.Error(err), zap.Int64("chat_id", chatID))
 	}
 
-	whitelistedUsersStr, err := t.redis.GetString(key + ":whitelisted_users")
-	if err != nil {
+	group, err := t.db.GetModeratedGroup(chatID)
+	if err != nil && !database.IsNotFound(err) {
 		return nil, err
 	}
-
-	eveningMessage, err := t.redis.GetString(key + ":evening_message")
 	if err != nil {
-		return nil, err
+		group = nil
 	}
 
-	morningMessage, err := t.redis.GetString(key + ":morning_message")
-	if err != nil {
-		return nil, err
+	data, err = json.Marshal(group)
+	if err == nil {
+		err = t.redis.SetWithTTL(key, data, moderatedGroupTTL)
 	}
-
-	moderateLinksStr, err := t.redis.GetString(key + ":moderate_links")
 	if err != nil {
-		return nil, err
+		zap.L().Error("Не удалось сохранить настройки группы в редис", zap.Error(err), zap.Int64("chat_id", chatID))
 	}
 
-	moderateScheduledStr, err := t.redis.GetString(key + ":moderate_scheduled")
-	if err != nil {
-		return nil, err
+	if group == nil {
+		return nil, errNotModerated
 	}
-
-	// Парсим данные
-	var whitelistedLinks []string
-	if whitelistedLinksStr != "" {
-		whitelistedLinks = strings.Split(whitelistedLinksStr, ",")
-	}
-
-	var whitelistedUsers []int64
-	if whitelistedUsersStr != "" {
-		for _, idStr := range strings.Split(whitelistedUsersStr, ",") {
-			id, err := strconv.ParseInt(idStr, 10, 64)
-			if err != nil {
-				continue
-			}
-			whitelistedUsers = append(whitelistedUsers, id)
-		}
-	}
-
-	moderateLinks, _ := strconv.ParseBool(moderateLinksStr)
-	moderateScheduled, _ := strconv.ParseBool(moderateScheduledStr)
-
-	return &ModeratedGroup{
-		ChatID:            chatID,
-		CloseTime:         closeTime,
-		OpenTime:          openTime,
-		WhitelistedLinks:  whitelistedLinks,
-		WhitelistedUsers:  whitelistedUsers,
-		EveningMessage:    eveningMessage,
-		MorningMessage:    morningMessage,
-		ModerateLinks:     moderateLinks,
-		ModerateScheduled: moderateScheduled,
-	}, nil
-}
-
-// getAllModeratedGroups получает все модерируемые группы
-func (t *Telegram) getAllModeratedGroups() ([]*ModeratedGroup, error) {
-	// В реальном приложении здесь должен быть запрос к базе данных
-	// В примере просто сканируем все ключи в Redis
-
-	// Это упрощенная реализация, в реальности нужно использовать паттерн сканирования Redis
-	// или хранить список групп в отдельном ключе
-
-	var groups []*ModeratedGroup
-
-	// Заглушка для примера
-	// В реальном приложении здесь будет запрос к Redis для получения всех ключей с префиксом "moderated_group:"
-
-	return groups, nil
+	return group, nil
 }
 
-// addToGlobalWhitelist добавляет слово/регулярное выражение в глобальный белый список
-func (t *Telegram) addToGlobalWhitelist(word string) error {
-	// Получаем текущий белый список
-	whitelist, err := t.getGlobalWhitelist()
+// invalidateModeratedGroup сбрасывает кеш настроек группы. Вызывается после каждого изменения
+// группы и ее списков, чтобы все копии бота сразу увидели новые настройки
+func (t *Telegram) invalidateModeratedGroup(chatID int64) {
+	err := t.redis.Del(moderatedGroupKey(chatID))
 	if err != nil {
-		// Если ошибка, создаем новый список
-		whitelist = []string{}
+		zap.L().Error("Не удалось сбросить кеш настроек группы", zap.Error(err), zap.Int64("chat_id", chatID))
 	}
-
-	// Добавляем новое слово
-	whitelist = append(whitelist, word)
-
-	// Сохраняем обновленный список
-	whitelistStr := strings.Join(whitelist, ",")
-	return t.redis.Set("global:whitelist", whitelistStr)
 }
 
-// getGlobalWhitelist получает глобальный белый список
-func (t *Telegram) getGlobalWhitelist() ([]string, error) {
-	whitelistStr, err := t.redis.GetString("global:whitelist")
-	if err != nil {
-		return nil, err
-	}
-
-	if whitelistStr == "" {
-		return []string{}, nil
-	}
-
-	return strings.Split(whitelistStr, ","), nil
+// getAllModeratedGroups получает все группы с включенной модерацией, где бот остается администратором.
+// Список читается из базы на каждом вызове, поэтому новые группы попадают в планировщик сразу
+func (t *Telegram) getAllModeratedGroups() ([]*database.ModeratedGroup, error) {
+	return t.db.GetEnabledModeratedGroups()
 }
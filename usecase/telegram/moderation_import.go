@@ -0,0 +1,227 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// ключи-флаги, которые ставятся после успешного переноса данных из редиса в базу
+const (
+	moderatedGroupsImportedKey = "migration:moderated_groups_imported"
+	globalWhitelistImportedKey = "migration:global_whitelist_imported"
+)
+
+// Ключ, в котором раньше хранился глобальный белый список: строка через запятую или JSON-массив
+const legacyGlobalWhitelistKey = "global:whitelist"
+
+// importRedisModeratedGroups разово переносит настройки групп, которые раньше
+// хранились в редисе по ключам moderated_group:<chat_id>:<поле>, в базу данных.
+// Группы, которые уже есть в базе, не перезаписываются. Старые ключи не удаляются.
+// Если какую-то группу прочитать не удалось, перенос повторится при следующем запуске,
+// а владельцы из конфига получат список таких групп
+func (t *Telegram) importRedisModeratedGroups() error {
+	if t.redis.Has(moderatedGroupsImportedKey) {
+		return nil
+	}
+
+	logger := zap.L().Named("ModeratedGroupsImport")
+
+	// Признаком существования группы в старой схеме был ключ close_time
+	keys, err := t.redis.Keys("moderated_group:*:close_time")
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	var failed []string
+	for _, key := range keys {
+		idStr := strings.TrimSuffix(strings.TrimPrefix(key, "moderated_group:"), ":close_time")
+		chatID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			logger.Warn("Некорректный ключ группы", zap.String("key", key))
+			continue
+		}
+
+		exists, err := t.db.HasModeratedGroup(chatID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		group, err := t.readRedisModeratedGroup(chatID)
+		if err != nil {
+			logger.Error("Не удалось прочитать группу из редиса", zap.Error(err), zap.Int64("chat_id", chatID))
+			failed = append(failed, idStr)
+			continue
+		}
+
+		err = t.db.CreateModeratedGroup(group)
+		if err != nil {
+			return err
+		}
+		t.invalidateModeratedGroup(group.ChatID)
+		imported++
+	}
+
+	logger.Info("Перенос групп завершен",
+		zap.Int("found", len(keys)),
+		zap.Int("imported", imported),
+		zap.Strings("failed", failed))
+
+	if len(failed) > 0 {
+		t.notifyOwners("Не удалось перенести настройки групп из редиса, перенос повторится при следующем запуске. " +
+			"ID групп:\n" + strings.Join(failed, "\n"))
+		return nil
+	}
+
+	return t.redis.Set(moderatedGroupsImportedKey, "1")
+}
+
+// readRedisModeratedGroup читает группу в старом формате хранения в редисе
+func (t *Telegram) readRedisModeratedGroup(chatID int64) (*database.ModeratedGroup, error) {
+	key := fmt.Sprintf("moderated_group:%d", chatID)
+
+	fields := map[string]string{}
+	for _, field := range []string{
+		"close_time",
+		"open_time",
+		"whitelisted_links",
+		"whitelisted_users",
+		"evening_message",
+		"morning_message",
+		"moderate_links",
+		"moderate_scheduled",
+	} {
+		value, err := t.redis.GetString(key + ":" + field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		fields[field] = value
+	}
+
+	group := &database.ModeratedGroup{
+		ChatID:          chatID,
+		EveningMessage:  fields["evening_message"],
+		MorningMessage:  fields["morning_message"],
+		WarnExpireHours: database.DefaultWarnExpireHours,
+		CaptchaTimeout:  120,
+		CaptchaType:     captchaButton,
+	}
+
+	if fields["close_time"] != "" && fields["open_time"] != "" {
+		group.ScheduleWindows = database.DailyScheduleWindows(fields["close_time"], fields["open_time"])
+	}
+
+	if fields["whitelisted_links"] != "" {
+		for _, link := range strings.Split(fields["whitelisted_links"], ",") {
+			entry := legacyLinkEntry(link)
+			group.WhitelistedLinks = append(group.WhitelistedLinks, database.WhitelistedLink{
+				Kind: entry.Kind,
+				Link: entry.Pattern,
+			})
+		}
+	}
+
+	if fields["whitelisted_users"] != "" {
+		for _, idStr := range strings.Split(fields["whitelisted_users"], ",") {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				continue
+			}
+			group.WhitelistedUsers = append(group.WhitelistedUsers, database.WhitelistedUser{
+				UserID: id,
+			})
+		}
+	}
+
+	group.ModerateLinks, _ = strconv.ParseBool(fields["moderate_links"])
+	group.ModerateScheduled, _ = strconv.ParseBool(fields["moderate_scheduled"])
+
+	return group, nil
+}
+
+// importRedisGlobalWhitelist разово переносит глобальный белый список из редиса в базу.
+// Записи, которые не разбираются как домен, ссылка, юзернейм или выражение (например, просто слова),
+// пропускаются: о них пишется в лог и владельцам из конфига. Старый ключ не удаляется
+func (t *Telegram) importRedisGlobalWhitelist() error {
+	if t.redis.Has(globalWhitelistImportedKey) {
+		return nil
+	}
+
+	logger := zap.L().Named("GlobalWhitelistImport")
+
+	var values []string
+	if t.redis.Has(legacyGlobalWhitelistKey) {
+		value, err := t.redis.GetString(legacyGlobalWhitelistKey)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(value, "[") {
+			err = json.Unmarshal([]byte(value), &values)
+			if err != nil {
+				return err
+			}
+		} else if value != "" {
+			values = strings.Split(value, ",")
+		}
+	}
+
+	imported := 0
+	var skipped []string
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		entry, err := parseWhitelistEntry(value)
+		if err != nil {
+			skipped = append(skipped, value)
+			continue
+		}
+
+		added, err := t.db.AddGlobalWhitelistEntry(&database.GlobalWhitelistEntry{
+			Kind:    entry.Kind,
+			Pattern: entry.Pattern,
+		})
+		if err != nil {
+			return err
+		}
+		if added {
+			imported++
+		}
+	}
+
+	t.invalidateGlobalWhitelist()
+
+	logger.Info("Перенос глобального белого списка завершен",
+		zap.Int("found", len(values)),
+		zap.Int("imported", imported),
+		zap.Strings("skipped", skipped))
+
+	if len(skipped) > 0 {
+		t.notifyOwners("При переносе глобального белого списка пропущены записи, которые не похожи на домен, ссылку, " +
+			"юзернейм или регулярное выражение:\n" + strings.Join(skipped, "\n") +
+			"\n\nЕсли они нужны, добавьте их заново командой /whitelist.\n\n" + whitelistHelp)
+	}
+
+	return t.redis.Set(globalWhitelistImportedKey, "1")
+}
+
+// notifyOwners сообщает владельцам из конфига о проблемах переноса старых данных
+func (t *Telegram) notifyOwners(text string) {
+	for id := range t.auth.owners {
+		_, err := t.bot.Send(&tele.User{ID: id}, text)
+		if err != nil {
+			zap.L().Warn("Не удалось отправить сообщение владельцу", zap.Error(err), zap.Int64("user_id", id))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Сколько строк списка показывается на одной странице
+const pageSize = 20
+
+// Кнопка перелистывания страниц. В данных кнопки передаются имя списка, номер страницы
+// и параметры списка, например фильтры. Телеграм ограничивает данные кнопки 64 байтами
+var pageButton = &tele.Btn{Unique: "page"}
+
+// listProvider собирает строки списка для текущего чата и проверяет права того, кто его смотрит.
+// params - параметры, с которыми список был открыт. Ошибка показывается пользователю как есть
+type listProvider func(ctx tele.Context, params []string) (title string, items []string, err error)
+
+// registerList регистрирует список, который можно листать кнопками
+func (t *Telegram) registerList(name string, provider listProvider) {
+	if t.lists == nil {
+		t.lists = map[string]listProvider{}
+	}
+	t.lists[name] = provider
+}
+
+// setupPagination регистрирует обработчик кнопок перелистывания
+func (t *Telegram) setupPagination() {
+	t.bot.Handle(pageButton, t.onPage)
+}
+
+// sendList отправляет первую страницу зарегистрированного списка в ответ на команду
+func (t *Telegram) sendList(ctx tele.Context, name string, params ...string) error {
+	provider, ok := t.lists[name]
+	if !ok {
+		return fmt.Errorf("unknown list %q", name)
+	}
+
+	title, items, err := provider(ctx, params)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	text, markup := renderPage(name, params, title, items, 0)
+
+	return ctx.Reply(text, markup)
+}
+
+// onPage показывает другую страницу списка по нажатию кнопки
+func (t *Telegram) onPage(ctx tele.Context) error {
+	args := ctx.Args()
+	if len(args) < 2 {
+		return ctx.Respond()
+	}
+
+	provider, ok := t.lists[args[0]]
+	page, err := strconv.Atoi(args[1])
+	if !ok || err != nil {
+		return ctx.Respond()
+	}
+
+	title, items, err := provider(ctx, args[2:])
+	if err != nil {
+		return ctx.Respond(&tele.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+
+	text, markup := renderPage(args[0], args[2:], title, items, page)
+	err = ctx.Edit(text, markup)
+	if err != nil && !errors.Is(err, tele.ErrSameMessageContent) && !errors.Is(err, tele.ErrMessageNotModified) {
+		zap.L().Error("Не удалось показать страницу списка", zap.Error(err), zap.String("list", args[0]))
+	}
+
+	return ctx.Respond()
+}
+
+// renderPage выводит страницу списка с нумерацией строк и кнопками перелистывания.
+// Номер страницы за пределами списка приводится к ближайшей существующей
+func renderPage(name string, params []string, title string, items []string, page int) (string, *tele.ReplyMarkup) {
+	pages := (len(items) + pageSize - 1) / pageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	var b strings.Builder
+	b.WriteString(title + "\n\n")
+	if len(items) == 0 {
+		b.WriteString("Список пуст\n")
+	}
+
+	from := page * pageSize
+	to := from + pageSize
+	if to > len(items) {
+		to = len(items)
+	}
+	for i := from; i < to; i++ {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, items[i]))
+	}
+
+	markup := &tele.ReplyMarkup{}
+	if pages > 1 {
+		b.WriteString(fmt.Sprintf("\nСтраница %d из %d", page+1, pages))
+
+		var row tele.Row
+		if page > 0 {
+			row = append(row, markup.Data("◀", pageButton.Unique, append([]string{name, strconv.Itoa(page - 1)}, params...)...))
+		}
+		if page < pages-1 {
+			row = append(row, markup.Data("▶", pageButton.Unique, append([]string{name, strconv.Itoa(page + 1)}, params...)...))
+		}
+		markup.Inline(row)
+	}
+
+	return b.String(), markup
+}
@@ -0,0 +1,222 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Права, которые выставляются при открытии, если у группы нет ни снимка, ни явного профиля
+var defaultOpenPermissions = database.ChatPermissions{
+	CanSendMessages:   true,
+	CanSendAudios:     true,
+	CanSendDocuments:  true,
+	CanSendPhotos:     true,
+	CanSendVideos:     true,
+	CanSendVideoNotes: true,
+	CanSendVoiceNotes: true,
+	CanSendPolls:      true,
+	CanSendOther:      true,
+	CanAddPreviews:    true,
+	CanInviteUsers:    true,
+}
+
+// Названия прав для команды /permissions
+var permissionNames = []string{
+	"messages", "audios", "documents", "photos", "videos", "video_notes", "voice_notes",
+	"polls", "other", "previews", "info", "invite", "pin", "topics",
+}
+
+// permissionField возвращает указатель на поле прав по названию из команды /permissions
+func permissionField(p *database.ChatPermissions, name string) *bool {
+	switch name {
+	case "messages":
+		return &p.CanSendMessages
+	case "audios":
+		return &p.CanSendAudios
+	case "documents":
+		return &p.CanSendDocuments
+	case "photos":
+		return &p.CanSendPhotos
+	case "videos":
+		return &p.CanSendVideos
+	case "video_notes":
+		return &p.CanSendVideoNotes
+	case "voice_notes":
+		return &p.CanSendVoiceNotes
+	case "polls":
+		return &p.CanSendPolls
+	case "other":
+		return &p.CanSendOther
+	case "previews":
+		return &p.CanAddPreviews
+	case "info":
+		return &p.CanChangeInfo
+	case "invite":
+		return &p.CanInviteUsers
+	case "pin":
+		return &p.CanPinMessages
+	case "topics":
+		return &p.CanManageTopics
+	}
+
+	return nil
+}
+
+// permissionsFromRights переводит права чата из ответа getChat в формат хранения
+func permissionsFromRights(rights tele.Rights) *database.ChatPermissions {
+	return &database.ChatPermissions{
+		CanSendMessages:   rights.CanSendMessages,
+		CanSendAudios:     rights.CanSendAudios,
+		CanSendDocuments:  rights.CanSendDocuments,
+		CanSendPhotos:     rights.CanSendPhotos,
+		CanSendVideos:     rights.CanSendVideos,
+		CanSendVideoNotes: rights.CanSendVideoNotes,
+		CanSendVoiceNotes: rights.CanSendVoiceNotes,
+		CanSendPolls:      rights.CanSendPolls,
+		CanSendOther:      rights.CanSendOther,
+		CanAddPreviews:    rights.CanAddPreviews,
+		CanChangeInfo:     rights.CanChangeInfo,
+		CanInviteUsers:    rights.CanInviteUsers,
+		CanPinMessages:    rights.CanPinMessages,
+		CanManageTopics:   rights.CanManageTopics,
+	}
+}
+
+// rightsFromPermissions переводит сохраненные права в формат setChatPermissions.
+// Права выставляются независимо, чтобы телеграм не включал медиа вместе с сообщениями
+func rightsFromPermissions(p database.ChatPermissions) tele.Rights {
+	return tele.Rights{
+		CanSendMessages:   p.CanSendMessages,
+		CanSendAudios:     p.CanSendAudios,
+		CanSendDocuments:  p.CanSendDocuments,
+		CanSendPhotos:     p.CanSendPhotos,
+		CanSendVideos:     p.CanSendVideos,
+		CanSendVideoNotes: p.CanSendVideoNotes,
+		CanSendVoiceNotes: p.CanSendVoiceNotes,
+		CanSendPolls:      p.CanSendPolls,
+		CanSendOther:      p.CanSendOther,
+		CanAddPreviews:    p.CanAddPreviews,
+		CanChangeInfo:     p.CanChangeInfo,
+		CanInviteUsers:    p.CanInviteUsers,
+		CanPinMessages:    p.CanPinMessages,
+		CanManageTopics:   p.CanManageTopics,
+		Independent:       true,
+	}
+}
+
+// canWrite проверяет, могут ли участники хоть что-то отправлять в чат.
+// Снимок с уже закрытого чата бесполезен, поэтому такие права не сохраняются
+func canWrite(p *database.ChatPermissions) bool {
+	return p.CanSendMessages || p.CanSendAudios || p.CanSendDocuments || p.CanSendPhotos ||
+		p.CanSendVideos || p.CanSendVideoNotes || p.CanSendVoiceNotes || p.CanSendPolls || p.CanSendOther
+}
+
+// groupOpenPermissions возвращает права, которые нужно выставить при открытии чата:
+// явный профиль админов, иначе снимок, сделанный перед закрытием, иначе права по умолчанию
+func groupOpenPermissions(group *database.ModeratedGroup) database.ChatPermissions {
+	if group.OpenPermissions != nil {
+		return *group.OpenPermissions
+	}
+	if group.SnapshotPermissions != nil {
+		return *group.SnapshotPermissions
+	}
+
+	return defaultOpenPermissions
+}
+
+// snapshotPermissions запоминает текущие права участников чата перед его закрытием
+func (t *Telegram) snapshotPermissions(group *database.ModeratedGroup) {
+	chat, err := t.bot.ChatByID(group.ChatID)
+	if err != nil {
+		zap.L().Error("Не удалось получить права чата", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+		return
+	}
+	if chat.Permissions == nil {
+		return
+	}
+
+	permissions := permissionsFromRights(*chat.Permissions)
+	if !canWrite(permissions) {
+		return
+	}
+
+	err = t.db.SetModeratedGroupSnapshot(group.ChatID, permissions)
+	if err != nil {
+		zap.L().Error("Не удалось сохранить права чата", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+		return
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	group.SnapshotPermissions = permissions
+}
+
+// formatPermissions выводит права в виде списка name=on/off
+func formatPermissions(p database.ChatPermissions) string {
+	var b strings.Builder
+	for _, name := range permissionNames {
+		state := "off"
+		if *permissionField(&p, name) {
+			state = "on"
+		}
+		b.WriteString(fmt.Sprintf("%s=%s\n", name, state))
+	}
+
+	return b.String()
+}
+
+// cmdPermissions показывает и меняет права, которые выставляются при открытии чата
+func (t *Telegram) cmdPermissions(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		source := "права по умолчанию"
+		if group.OpenPermissions != nil {
+			source = "заданы админами"
+		} else if group.SnapshotPermissions != nil {
+			source = "сохранены перед последним закрытием"
+		}
+
+		return ctx.Reply(fmt.Sprintf("Права участников при открытии чата (%s):\n\n%s\n"+
+			"/permissions set messages=on polls=off ... - задать права явно\n"+
+			"/permissions reset - восстанавливать права, сохраненные перед закрытием\n\n"+
+			"Доступные права: %s", source, formatPermissions(groupOpenPermissions(group)), strings.Join(permissionNames, ", ")))
+	}
+
+	switch args[0] {
+	case "reset":
+		group.OpenPermissions = nil
+	case "set":
+		if len(args) < 2 {
+			return ctx.Reply("Пожалуйста, укажите права, например: /permissions set messages=on invite=off")
+		}
+
+		permissions := groupOpenPermissions(group)
+		for _, arg := range args[1:] {
+			parts := strings.SplitN(strings.ToLower(arg), "=", 2)
+			field := permissionField(&permissions, parts[0])
+			if field == nil || len(parts) != 2 || (parts[1] != "on" && parts[1] != "off") {
+				return ctx.Reply(fmt.Sprintf("Некорректное право '%s'. Используйте название=on или название=off, доступные права: %s",
+					arg, strings.Join(permissionNames, ", ")))
+			}
+			*field = parts[1] == "on"
+		}
+		group.OpenPermissions = &permissions
+	default:
+		return ctx.Reply("Неизвестная команда. Используйте /permissions, /permissions set или /permissions reset")
+	}
+
+	err := t.saveModeratedGroup(group, "OpenPermissions")
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+
+	return ctx.Reply("Права при открытии чата обновлены:\n\n" + formatPermissions(groupOpenPermissions(group)))
+}
@@ -0,0 +1,195 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Телеграм считает ограничения длиннее 366 дней бессрочными
+const maxSanctionDuration = 366 * 24 * time.Hour
+
+var (
+	errNoRestrictRights    = errors.New("У вас нет права ограничивать участников в этом чате")
+	errBotNoRestrictRights = errors.New("Бот не может ограничивать участников: сделайте его администратором с правом блокировки")
+)
+
+// setupRestrictions регистрирует команды ручных наказаний
+func (t *Telegram) setupRestrictions() {
+	t.bot.Handle("/ban", t.cmdBan)
+	t.bot.Handle("/mute", t.cmdMute)
+	t.bot.Handle("/kick", t.cmdKick)
+	t.bot.Handle("/unban", t.cmdUnban)
+	t.bot.Handle("/unmute", t.cmdUnmute)
+}
+
+// checkRestrictRights проверяет права вызвавшего команду и самого бота
+func (t *Telegram) checkRestrictRights(ctx tele.Context) error {
+	if !isGroupChat(ctx.Chat()) {
+		return errGroupOnly
+	}
+
+	allowed, err := t.auth.canRestrict(ctx.Chat(), ctx.Sender())
+	if err != nil {
+		zap.L().Error("Не удалось проверить права участника", zap.Error(err))
+		return errNoRestrictRights
+	}
+	if !allowed {
+		return errNoRestrictRights
+	}
+
+	allowed, err = t.auth.hasRestrictRight(ctx.Chat(), t.bot.Me)
+	if err != nil {
+		zap.L().Error("Не удалось проверить права бота", zap.Error(err))
+		return errBotNoRestrictRights
+	}
+	if !allowed {
+		return errBotNoRestrictRights
+	}
+
+	return nil
+}
+
+// restrictTarget определяет участника для наказания и проверяет, что его можно наказать
+func (t *Telegram) restrictTarget(ctx tele.Context) (*tele.User, []string, error) {
+	err := t.checkRestrictRights(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, args, err := t.resolveTarget(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.ID == t.bot.Me.ID {
+		return nil, nil, errors.New("Бот не может наказать сам себя")
+	}
+
+	member, err := t.bot.ChatMemberOf(ctx.Chat(), user)
+	if err == nil && (member.Role == tele.Creator || member.Role == tele.Administrator) {
+		return nil, nil, errors.New("Администраторов чата наказать нельзя")
+	}
+
+	return user, args, nil
+}
+
+// cmdBan банит участника: /ban [@username|ID] [срок] [причина] или ответом на сообщение
+func (t *Telegram) cmdBan(ctx tele.Context) error {
+	return t.restrictCommand(ctx, database.SanctionBan)
+}
+
+// cmdMute запрещает участнику писать: /mute [@username|ID] [срок] [причина] или ответом на сообщение
+func (t *Telegram) cmdMute(ctx tele.Context) error {
+	return t.restrictCommand(ctx, database.SanctionMute)
+}
+
+// cmdKick исключает участника из чата, вернуться он может по ссылке: /kick [@username|ID] [причина]
+func (t *Telegram) cmdKick(ctx tele.Context) error {
+	return t.restrictCommand(ctx, database.SanctionKick)
+}
+
+// restrictCommand общий обработчик команд наказаний. Срок необязателен, без него наказание бессрочное
+func (t *Telegram) restrictCommand(ctx tele.Context, action string) error {
+	user, args, err := t.restrictTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	var duration time.Duration
+	if action != database.SanctionKick && len(args) > 0 {
+		if parsed, err := parseDuration(args[0]); err == nil {
+			if parsed > maxSanctionDuration {
+				return ctx.Reply("Срок не может быть больше 366 дней. Для бессрочного наказания не указывайте срок")
+			}
+			duration = parsed
+			args = args[1:]
+		}
+	}
+	reason := strings.Join(args, " ")
+
+	err = t.applySanction(ctx.Chat(), user, action, duration)
+	if err != nil {
+		zap.L().Error("Не удалось применить наказание",
+			zap.Error(err),
+			zap.Int64("chat_id", ctx.Chat().ID),
+			zap.Int64("user_id", user.ID),
+			zap.String("action", action))
+		return ctx.Reply("Не удалось применить наказание, проверьте права бота")
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   ctx.Chat().ID,
+		TargetID: user.ID,
+		ActorID:  ctx.Sender().ID,
+		Action:   action,
+		Duration: int64(duration / time.Second),
+		Reason:   reason,
+		Excerpt:  messageExcerpt(repliedMessage(ctx.Message())),
+	})
+
+	text := fmt.Sprintf("%s: %s", formatUser(user), formatSanction(action, duration))
+	if reason != "" {
+		text += "\nПричина: " + reason
+	}
+
+	return ctx.Reply(text)
+}
+
+// cmdUnban снимает бан, не исключая участника, если он уже в чате
+func (t *Telegram) cmdUnban(ctx tele.Context) error {
+	err := t.checkRestrictRights(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	user, args, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	err = t.bot.Unban(ctx.Chat(), user, true)
+	if err != nil {
+		zap.L().Error("Не удалось разбанить участника", zap.Error(err), zap.Int64("chat_id", ctx.Chat().ID))
+		return ctx.Reply("Не удалось снять бан, проверьте права бота")
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   ctx.Chat().ID,
+		TargetID: user.ID,
+		ActorID:  ctx.Sender().ID,
+		Action:   actionUnban,
+		Reason:   strings.Join(args, " "),
+	})
+
+	return ctx.Reply(fmt.Sprintf("%s разбанен и может вернуться в чат", formatUser(user)))
+}
+
+// cmdUnmute снимает с участника все ограничения. После этого на него действуют общие права чата
+func (t *Telegram) cmdUnmute(ctx tele.Context) error {
+	user, args, err := t.restrictTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	err = t.liftRestrictions(ctx.Chat(), user)
+	if err != nil {
+		zap.L().Error("Не удалось снять ограничения", zap.Error(err), zap.Int64("chat_id", ctx.Chat().ID))
+		return ctx.Reply("Не удалось снять ограничения, проверьте права бота")
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   ctx.Chat().ID,
+		TargetID: user.ID,
+		ActorID:  ctx.Sender().ID,
+		Action:   actionUnmute,
+		Reason:   strings.Join(args, " "),
+	})
+
+	return ctx.Reply(fmt.Sprintf("С %s сняты ограничения", formatUser(user)))
+}
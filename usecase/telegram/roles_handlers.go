@@ -0,0 +1,223 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Имя списка ролей для перелистывания
+const listRoles = "roles"
+
+// Названия ролей
+var roleNames = map[string]string{
+	database.RoleOwner:      "владелец",
+	database.RoleSuperadmin: "суперадминистратор",
+	database.RoleModerator:  "модератор",
+}
+
+// Подсказка по командам ролей
+const rolesHelp = "Использование: /grant пользователь роль, /revoke пользователь роль\n" +
+	"Пользователь указывается ответом на сообщение, @username или ID. Роли:\n" +
+	"moderator - настройки и предупреждения в этом чате без прав администратора в телеграме. " +
+	"Наказывать командами и менять лестницу наказаний модератор не может, а его предупреждения не приводят к наказаниям. Назначают создатель чата и администраторы с правом назначать администраторов\n" +
+	"superadmin - права во всех чатах и глобальный белый список, назначают владельцы\n" +
+	"owner - владелец бота, назначают владельцы\n" +
+	"/roles - модераторы группы, а в личной переписке - владельцы и суперадминистраторы"
+
+var (
+	errOwnerOnly      = errors.New("Эту роль могут назначать только владельцы бота")
+	errPromoteOnly    = errors.New("Модераторов назначают создатель чата и администраторы с правом назначать администраторов")
+	errSuperadminOnly = errors.New("Эта команда доступна только владельцам и суперадминистраторам бота")
+	errConfigOwner    = errors.New("Владелец указан в конфиге, убрать его можно только там")
+)
+
+// setupRoles регистрирует команды управления ролями
+func (t *Telegram) setupRoles() {
+	t.bot.Handle("/grant", t.cmdGrant)
+	t.bot.Handle("/revoke", t.cmdRevoke)
+	t.bot.Handle("/roles", t.cmdRoles)
+
+	t.registerList(listRoles, t.rolesList)
+}
+
+// roleScope проверяет, может ли отправитель назначать и снимать роль, и возвращает чат роли.
+// Владельцы и суперадминистраторы действуют во всех чатах, модератор - только в текущем
+func (t *Telegram) roleScope(ctx tele.Context, role string) (int64, error) {
+	switch role {
+	case database.RoleOwner, database.RoleSuperadmin:
+		if !t.auth.isOwner(ctx.Sender().ID) {
+			return 0, errOwnerOnly
+		}
+		return 0, nil
+	case database.RoleModerator:
+		if !isGroupChat(ctx.Chat()) {
+			return 0, errGroupOnly
+		}
+		allowed, err := t.auth.canManageModerators(ctx.Chat(), ctx.Sender())
+		if err != nil {
+			zap.L().Error("Не удалось получить список администраторов", zap.Error(err), zap.Int64("chat_id", ctx.Chat().ID))
+			return 0, errPromoteOnly
+		}
+		if !allowed {
+			return 0, errPromoteOnly
+		}
+		return ctx.Chat().ID, nil
+	}
+
+	return 0, errors.New(rolesHelp)
+}
+
+// roleTarget разбирает команду роли: пользователя, саму роль и чат, в котором она действует
+func (t *Telegram) roleTarget(ctx tele.Context) (*tele.User, string, int64, error) {
+	user, args, err := t.resolveTarget(ctx)
+	if errors.Is(err, errTargetMissing) {
+		return nil, "", 0, errors.New(rolesHelp)
+	}
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(args) != 1 {
+		return nil, "", 0, errors.New(rolesHelp)
+	}
+
+	role := strings.ToLower(args[0])
+	chatID, err := t.roleScope(ctx, role)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return user, role, chatID, nil
+}
+
+// cmdGrant назначает роль: /grant @username moderator или ответом на сообщение /grant moderator
+func (t *Telegram) cmdGrant(ctx tele.Context) error {
+	user, role, chatID, err := t.roleTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+	if user.IsBot {
+		return ctx.Reply("Роли нельзя назначать ботам")
+	}
+
+	err = t.auth.grant(&database.UserRole{
+		UserID:    user.ID,
+		ChatID:    chatID,
+		Role:      role,
+		GrantedBy: ctx.Sender().ID,
+	})
+	if err != nil {
+		zap.L().Error("Не удалось назначить роль", zap.Error(err), zap.Int64("user_id", user.ID), zap.String("role", role))
+		return ctx.Reply("Ошибка при назначении роли")
+	}
+
+	zap.L().Info("Назначена роль",
+		zap.Int64("user_id", user.ID),
+		zap.Int64("chat_id", chatID),
+		zap.String("role", role),
+		zap.Int64("granted_by", ctx.Sender().ID))
+
+	return ctx.Reply(formatUser(user) + " - " + roleNames[role])
+}
+
+// cmdRevoke снимает роль: /revoke @username moderator или ответом на сообщение /revoke moderator
+func (t *Telegram) cmdRevoke(ctx tele.Context) error {
+	user, role, chatID, err := t.roleTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+	if role == database.RoleOwner && t.auth.isConfigOwner(user.ID) {
+		return ctx.Reply(errConfigOwner.Error())
+	}
+
+	deleted, err := t.auth.revoke(user.ID, chatID, role)
+	if err != nil {
+		zap.L().Error("Не удалось снять роль", zap.Error(err), zap.Int64("user_id", user.ID), zap.String("role", role))
+		return ctx.Reply("Ошибка при снятии роли")
+	}
+	if !deleted {
+		return ctx.Reply("У пользователя нет этой роли")
+	}
+
+	zap.L().Info("Снята роль",
+		zap.Int64("user_id", user.ID),
+		zap.Int64("chat_id", chatID),
+		zap.String("role", role),
+		zap.Int64("revoked_by", ctx.Sender().ID))
+
+	return ctx.Reply(formatUser(user) + " больше не " + roleNames[role])
+}
+
+// cmdRoles показывает назначенные роли
+func (t *Telegram) cmdRoles(ctx tele.Context) error {
+	return t.sendList(ctx, listRoles)
+}
+
+// rolesList собирает роли для вывода по страницам: в группе - ее модераторов,
+// в личной переписке - владельцев и суперадминистраторов
+func (t *Telegram) rolesList(ctx tele.Context, _ []string) (string, []string, error) {
+	if isGroupChat(ctx.Chat()) {
+		if !t.auth.isAdmin(ctx.Chat(), ctx.Sender()) {
+			return "", nil, errAdminOnly
+		}
+
+		roles, err := t.auth.chatRoles(ctx.Chat().ID)
+		if err != nil {
+			zap.L().Error("Не удалось получить роли", zap.Error(err), zap.Int64("chat_id", ctx.Chat().ID))
+			return "", nil, errors.New("Ошибка при получении ролей")
+		}
+		ids := make([]int64, 0, len(roles))
+		for _, role := range roles {
+			ids = append(ids, role.UserID)
+		}
+
+		return "Модераторы группы. Назначить: /grant пользователь moderator", t.formatRoleUsers(ids, nil), nil
+	}
+
+	if !t.auth.isSuperadmin(ctx.Sender().ID) {
+		return "", nil, errSuperadminOnly
+	}
+
+	roles, err := t.auth.chatRoles(0)
+	if err != nil {
+		zap.L().Error("Не удалось получить роли", zap.Error(err))
+		return "", nil, errors.New("Ошибка при получении ролей")
+	}
+
+	labels := map[int64]string{}
+	var ids []int64
+	for id := range t.auth.owners {
+		ids = append(ids, id)
+		labels[id] = roleNames[database.RoleOwner] + " (из конфига)"
+	}
+	for _, role := range roles {
+		if _, ok := labels[role.UserID]; ok {
+			continue
+		}
+		ids = append(ids, role.UserID)
+		labels[role.UserID] = roleNames[role.Role]
+	}
+
+	return "Владельцы и суперадминистраторы бота", t.formatRoleUsers(ids, labels), nil
+}
+
+// formatRoleUsers выводит пользователей с подписями по возрастанию ID
+func (t *Telegram) formatRoleUsers(ids []int64, labels map[int64]string) []string {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	users := t.knownUsers(ids)
+	items := make([]string, 0, len(ids))
+	for _, id := range ids {
+		item := formatUser(users[id])
+		if label := labels[id]; label != "" {
+			item += " - " + label
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
@@ -0,0 +1,125 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Единицы длительности в командах: 30m, 12h, 2d, 1w или по-русски 30м, 12ч, 2д, 1н
+var durationUnits = map[string]time.Duration{
+	"m": time.Minute, "м": time.Minute,
+	"h": time.Hour, "ч": time.Hour,
+	"d": 24 * time.Hour, "д": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "н": 7 * 24 * time.Hour,
+}
+
+// Названия наказаний для сообщений в чате
+var sanctionNames = map[string]string{
+	database.SanctionMute: "мут",
+	database.SanctionKick: "исключение из чата",
+	database.SanctionBan:  "бан",
+}
+
+// parseDuration разбирает длительность вида 30m, 12h, 2d или 1w не длиннее maxSanctionDuration
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(value)
+	unit, size := utf8.DecodeLastRuneInString(value)
+	if size == 0 {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	multiplier, ok := durationUnits[string(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unknown duration unit in %q", value)
+	}
+
+	amount, err := strconv.Atoi(value[:len(value)-size])
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	// Проверка до умножения: большое число переполнило бы time.Duration
+	if amount > int(maxSanctionDuration/multiplier) {
+		return 0, fmt.Errorf("duration %q is too long", value)
+	}
+
+	return time.Duration(amount) * multiplier, nil
+}
+
+// formatDuration выводит длительность в самых крупных целых единицах. Нулевая длительность - навсегда
+func formatDuration(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "навсегда"
+	case d%(7*24*time.Hour) == 0:
+		return fmt.Sprintf("%d нед.", d/(7*24*time.Hour))
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d дн.", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d ч", d/time.Hour)
+	}
+
+	return fmt.Sprintf("%d мин", d/time.Minute)
+}
+
+// formatSanction выводит наказание с длительностью, например "мут на 1 ч"
+func formatSanction(action string, duration time.Duration) string {
+	name := sanctionNames[action]
+	if action == database.SanctionKick {
+		return name
+	}
+	if duration <= 0 {
+		return name + " навсегда"
+	}
+
+	return name + " на " + formatDuration(duration)
+}
+
+// untilDate возвращает момент окончания наказания для API телеграма. 0 - навсегда
+func untilDate(duration time.Duration) int64 {
+	if duration <= 0 {
+		return 0
+	}
+
+	return time.Now().Add(duration).Unix()
+}
+
+// applySanction применяет наказание к участнику чата. Исключение - это бан с немедленным разбаном,
+// чтобы пользователь мог вернуться по ссылке
+func (t *Telegram) applySanction(chat *tele.Chat, user *tele.User, action string, duration time.Duration) error {
+	switch action {
+	case database.SanctionMute:
+		return t.bot.Restrict(chat, &tele.ChatMember{
+			User:            user,
+			Rights:          tele.Rights{Independent: true},
+			RestrictedUntil: untilDate(duration),
+		})
+	case database.SanctionKick:
+		err := t.bot.Ban(chat, &tele.ChatMember{User: user})
+		if err != nil {
+			return err
+		}
+		return t.bot.Unban(chat, user, true)
+	case database.SanctionBan:
+		return t.bot.Ban(chat, &tele.ChatMember{User: user, RestrictedUntil: untilDate(duration)})
+	}
+
+	return fmt.Errorf("unknown sanction %q", action)
+}
+
+// liftRestrictions снимает с участника личные ограничения. После этого на него действуют общие права чата
+func (t *Telegram) liftRestrictions(chat *tele.Chat, user *tele.User) error {
+	rights := tele.NoRestrictions()
+	rights.CanChangeInfo = true
+	rights.CanInviteUsers = true
+	rights.CanPinMessages = true
+	rights.CanManageTopics = true
+	rights.Independent = true
+
+	return t.bot.Restrict(chat, &tele.ChatMember{User: user, Rights: rights})
+}
@@ -0,0 +1,52 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30m", want: 30 * time.Minute},
+		{value: "12h", want: 12 * time.Hour},
+		{value: "2d", want: 48 * time.Hour},
+		{value: "1w", want: 7 * 24 * time.Hour},
+		{value: "30М", want: 30 * time.Minute},
+		{value: "12ч", want: 12 * time.Hour},
+		{value: "2д", want: 48 * time.Hour},
+		{value: "1н", want: 7 * 24 * time.Hour},
+		{value: "366d", want: maxSanctionDuration},
+		{value: "367d", wantErr: true},
+		{value: "53w", wantErr: true},
+		{value: "99999999999999999m", wantErr: true},
+		{value: "9223372036854775807h", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "m", wantErr: true},
+		{value: "0h", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "10", wantErr: true},
+		{value: "10s", wantErr: true},
+		{value: "1.5h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDuration(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDuration(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
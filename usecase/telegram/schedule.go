@@ -0,0 +1,355 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Формат даты исключений расписания
+const scheduleDateLayout = "2006-01-02"
+
+// Короткие названия дней недели в порядке time.Weekday
+var weekdayNames = []string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+
+// Синонимы дней недели, которые принимают команды расписания
+var weekdayAliases = map[string]int{
+	"вс": 0, "пн": 1, "вт": 2, "ср": 3, "чт": 4, "пт": 5, "сб": 6,
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Наборы дней недели, которые можно указать одним словом
+var weekdaySets = map[string][]int{
+	"все":       {0, 1, 2, 3, 4, 5, 6},
+	"ежедневно": {0, 1, 2, 3, 4, 5, 6},
+	"daily":     {0, 1, 2, 3, 4, 5, 6},
+	"будни":     {1, 2, 3, 4, 5},
+	"weekdays":  {1, 2, 3, 4, 5},
+	"выходные":  {6, 0},
+	"weekend":   {6, 0},
+}
+
+// Время в расписании: ровно две цифры часов и две цифры минут
+var clockRe = regexp.MustCompile(`^\d{2}:\d{2}$`)
+
+// groupLocation возвращает часовой пояс группы. Если пояс не задан
+// или не загружается, используется пояс по умолчанию из конфига
+func (t *Telegram) groupLocation(group *database.ModeratedGroup) *time.Location {
+	if group.TimeZone != "" {
+		loc, err := time.LoadLocation(group.TimeZone)
+		if err == nil {
+			return loc
+		}
+		zap.L().Error("Некорректный часовой пояс группы", zap.Error(err), zap.Int64("chat_id", group.ChatID))
+	}
+
+	return t.defaultLocation()
+}
+
+// defaultLocation возвращает часовой пояс из конфига, а если он не загружается - UTC
+func (t *Telegram) defaultLocation() *time.Location {
+	loc, err := time.LoadLocation(t.config.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// parseClock разбирает время в формате ЧЧ:ММ и возвращает количество минут от начала суток
+func parseClock(value string) (int, error) {
+	if !clockRe.MatchString(value) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	hours, _ := strconv.Atoi(value[:2])
+	minutes, _ := strconv.Atoi(value[3:])
+	if hours > 23 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	return hours*60 + minutes, nil
+}
+
+// parseWindowEnd разбирает конец окна расписания. В отличие от parseClock допускает 24:00
+func parseWindowEnd(value string) (int, error) {
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+
+	return parseClock(value)
+}
+
+// formatClock приводит количество минут от начала суток к виду ЧЧ:ММ
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// parseWindowRange разбирает окно вида ЧЧ:ММ-ЧЧ:ММ и возвращает нормализованные границы
+func parseWindowRange(value string) (string, string, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid window %q", value)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return "", "", err
+	}
+	end, err := parseWindowEnd(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	if start == end {
+		return "", "", fmt.Errorf("empty window %q", value)
+	}
+
+	return formatClock(start), formatClock(end), nil
+}
+
+// parseWeekdays разбирает список дней недели: "пн-пт", "сб,вс", "будни", "все"
+func parseWeekdays(value string) ([]int, error) {
+	value = strings.ToLower(value)
+	if days, ok := weekdaySets[value]; ok {
+		return days, nil
+	}
+
+	seen := map[int]bool{}
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid weekdays %q", part)
+		}
+
+		from, ok := weekdayAliases[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", bounds[0])
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, ok = weekdayAliases[bounds[1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown weekday %q", bounds[1])
+			}
+		}
+
+		// Диапазон идет по неделе с понедельника, поэтому "пт-пн" захватывает выходные
+		for day := from; ; day = (day + 1) % 7 {
+			if !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// scheduleException возвращает исключение расписания на указанную дату
+func scheduleException(group *database.ModeratedGroup, date string) *database.ScheduleException {
+	for i := range group.ScheduleExceptions {
+		if group.ScheduleExceptions[i].Date == date {
+			return &group.ScheduleExceptions[i]
+		}
+	}
+
+	return nil
+}
+
+// isClosedAt проверяет, должен ли чат быть закрыт в указанный момент по расписанию группы
+func (t *Telegram) isClosedAt(group *database.ModeratedGroup, now time.Time) bool {
+	return closedAtLocal(group, now.In(t.groupLocation(group)))
+}
+
+// closedAtLocal проверяет расписание для времени, уже переведенного в часовой пояс группы.
+// В день исключения действует только оно: чат закрыт или открыт целиком.
+// Окна, переходящие через полночь, продолжают действовать утром следующего дня,
+// если этот день не объявлен открытым
+func closedAtLocal(group *database.ModeratedGroup, local time.Time) bool {
+	if exception := scheduleException(group, local.Format(scheduleDateLayout)); exception != nil {
+		return exception.Closed
+	}
+
+	current := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+	yesterdayOpen := false
+	if exception := scheduleException(group, local.AddDate(0, 0, -1).Format(scheduleDateLayout)); exception != nil {
+		yesterdayOpen = !exception.Closed
+	}
+
+	for _, window := range group.ScheduleWindows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseWindowEnd(window.End)
+		if err != nil {
+			continue
+		}
+
+		if window.Weekday == today {
+			if start < end && current >= start && current < end {
+				return true
+			}
+			if start > end && current >= start {
+				return true
+			}
+		}
+
+		if window.Weekday == yesterday && start > end && current < end && !yesterdayOpen {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextScheduleChange ищет ближайший момент, когда состояние чата по расписанию изменится.
+// Состояние меняется только в полночь (из-за исключений), на границах окон и при переводе часов,
+// поэтому проверяются только эти моменты. Поиск ограничен восемью сутками, чтобы учесть недельный цикл
+func (t *Telegram) nextScheduleChange(group *database.ModeratedGroup, now time.Time) (time.Time, bool) {
+	local := now.In(t.groupLocation(group)).Truncate(time.Minute)
+	state := closedAtLocal(group, local)
+	limit := local.Add(8 * 24 * time.Hour)
+
+	// Со вчерашнего дня, потому что окно, начатое вчера, может закончиться сегодня
+	var changes []time.Time
+	for day := -1; day <= 8; day++ {
+		date := local.AddDate(0, 0, day)
+		changes = appendClockMoments(changes, date, 0)
+		if transition, ok := clockTransition(date); ok {
+			changes = append(changes, transition)
+		}
+
+		for _, window := range group.ScheduleWindows {
+			if window.Weekday != int(date.Weekday()) {
+				continue
+			}
+			start, err := parseClock(window.Start)
+			if err != nil {
+				continue
+			}
+			end, err := parseWindowEnd(window.End)
+			if err != nil {
+				continue
+			}
+			if end <= start {
+				end += 24 * 60
+			}
+
+			changes = appendClockMoments(changes, date, start)
+			changes = appendClockMoments(changes, date, end)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Before(changes[j]) })
+
+	for _, next := range changes {
+		if !next.After(local) {
+			continue
+		}
+		if next.After(limit) {
+			break
+		}
+		if closedAtLocal(group, next) != state {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// appendClockMoments добавляет моменты, когда часы в поясе даты показывают minutes минут от начала ее суток.
+// При переходе на летнее время такого момента нет, при переходе на зимнее их два
+func appendClockMoments(moments []time.Time, date time.Time, minutes int) []time.Time {
+	year, month, day := date.Date()
+	wall := time.Date(year, month, day, 0, minutes, 0, 0, time.UTC)
+	moment := time.Date(year, month, day, 0, minutes, 0, 0, date.Location())
+
+	for _, candidate := range []time.Time{moment.Add(-time.Hour), moment, moment.Add(time.Hour)} {
+		y, m, d := candidate.Date()
+		wy, wm, wd := wall.Date()
+		if y == wy && m == wm && d == wd && candidate.Hour() == wall.Hour() && candidate.Minute() == wall.Minute() {
+			moments = append(moments, candidate)
+		}
+	}
+
+	return moments
+}
+
+// clockTransition находит с точностью до минуты момент перевода часов в сутки даты, если он был
+func clockTransition(date time.Time) (time.Time, bool) {
+	year, month, day := date.Date()
+	from := time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+	to := time.Date(year, month, day+1, 0, 0, 0, 0, date.Location())
+
+	_, fromOffset := from.Zone()
+	_, toOffset := to.Zone()
+	if fromOffset == toOffset {
+		return time.Time{}, false
+	}
+
+	// Первая минута суток, когда действует уже новое смещение
+	minutes := sort.Search(int(to.Sub(from)/time.Minute), func(i int) bool {
+		_, offset := from.Add(time.Duration(i) * time.Minute).Zone()
+		return offset != fromOffset
+	})
+
+	return from.Add(time.Duration(minutes) * time.Minute), true
+}
+
+// formatSchedule выводит расписание группы в читаемом виде с номерами окон
+func formatSchedule(group *database.ModeratedGroup) string {
+	var b strings.Builder
+
+	if len(group.ScheduleWindows) == 0 {
+		b.WriteString("Окна закрытия не заданы\n")
+	}
+	for i, window := range group.ScheduleWindows {
+		b.WriteString(fmt.Sprintf("%d. %s %s - %s\n", i+1, weekdayNames[window.Weekday], window.Start, window.End))
+	}
+
+	if len(group.ScheduleExceptions) > 0 {
+		b.WriteString("\nИсключения:\n")
+	}
+	for _, exception := range group.ScheduleExceptions {
+		state := "открыт весь день"
+		if exception.Closed {
+			state = "закрыт весь день"
+		}
+		line := fmt.Sprintf("%s - %s", exception.Date, state)
+		if exception.Note != "" {
+			line += " (" + exception.Note + ")"
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return b.String()
+}
+
+// sortSchedule упорядочивает окна по дням недели (с понедельника) и времени, а исключения по дате
+func sortSchedule(group *database.ModeratedGroup) {
+	sort.SliceStable(group.ScheduleWindows, func(i, j int) bool {
+		a, b := group.ScheduleWindows[i], group.ScheduleWindows[j]
+		dayA, dayB := (a.Weekday+6)%7, (b.Weekday+6)%7
+		if dayA != dayB {
+			return dayA < dayB
+		}
+		return a.Start < b.Start
+	})
+
+	sort.SliceStable(group.ScheduleExceptions, func(i, j int) bool {
+		return group.ScheduleExceptions[i].Date < group.ScheduleExceptions[j].Date
+	})
+}
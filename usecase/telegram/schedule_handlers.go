@@ -0,0 +1,249 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Подсказка по командам расписания
+const scheduleHelp = "Команды расписания:\n" +
+	"/schedule_add дни ЧЧ:ММ-ЧЧ:ММ - добавить окно закрытия, например:\n" +
+	"  /schedule_add будни 22:00-09:00\n" +
+	"  /schedule_add выходные 00:00-24:00\n" +
+	"  /schedule_add пн-пт 13:00-14:00\n" +
+	"/schedule_remove номер - удалить окно\n" +
+	"/schedule_clear - удалить все окна\n" +
+	"/holiday ГГГГ-ММ-ДД [closed|open] [комментарий] - исключение на дату\n" +
+	"/holiday_remove ГГГГ-ММ-ДД - удалить исключение"
+
+// Ошибки проверок команд настройки группы. Текст показывается пользователю
+var (
+	errGroupOnly    = errors.New("Эта команда доступна только в группах")
+	errAdminOnly    = errors.New("Только администраторы могут использовать эту команду")
+	errNotModerated = errors.New("Эта группа не настроена для модерации. Используйте сначала команду /moderate")
+)
+
+// checkAdminChat проверяет, что команда пришла из группы от администратора
+func (t *Telegram) checkAdminChat(ctx tele.Context) error {
+	if !isGroupChat(ctx.Chat()) {
+		return errGroupOnly
+	}
+
+	// Проверяем права администратора
+	if !t.auth.isAdmin(ctx.Chat(), ctx.Sender()) {
+		return errAdminOnly
+	}
+
+	return nil
+}
+
+// adminGroup выполняет общие для команд настройки группы проверки и возвращает ее настройки
+func (t *Telegram) adminGroup(ctx tele.Context) (*database.ModeratedGroup, error) {
+	err := t.checkAdminChat(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := t.getModeratedGroup(ctx.Chat().ID)
+	if err != nil {
+		return nil, errNotModerated
+	}
+
+	sortSchedule(group)
+
+	return group, nil
+}
+
+// loadAdminGroup работает как adminGroup, но сам отвечает пользователю.
+// Если проверка не пройдена, ответ уже отправлен и возвращается nil
+func (t *Telegram) loadAdminGroup(ctx tele.Context) *database.ModeratedGroup {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		_ = ctx.Reply(err.Error())
+		return nil
+	}
+
+	return group
+}
+
+// replySchedule отвечает на изменение расписания и сбрасывает кеш группы. Расписание перечитывается из базы,
+// чтобы в ответе были и изменения других админов
+func (t *Telegram) replySchedule(ctx tele.Context, message string, err error) error {
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(ctx.Chat().ID)
+
+	group, err := t.getModeratedGroup(ctx.Chat().ID)
+	if err != nil {
+		zap.L().Error("Не удалось получить настройки группы", zap.Error(err))
+		return ctx.Reply(message)
+	}
+	sortSchedule(group)
+
+	return ctx.Reply(message + "\n\n" + formatSchedule(group))
+}
+
+// cmdSchedule показывает расписание закрытия чата
+func (t *Telegram) cmdSchedule(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	now := time.Now()
+	state := "открыт"
+	if t.isClosedAt(group, now) {
+		state = "закрыт"
+	}
+
+	status := fmt.Sprintf("Часовой пояс: %s. По расписанию чат сейчас %s", t.groupLocation(group), state)
+	if next, ok := t.nextScheduleChange(group, now); ok {
+		status += fmt.Sprintf(" до %s %s", weekdayNames[next.Weekday()], next.Format("15:04"))
+	}
+
+	return ctx.Reply(status + "\n\n" + formatSchedule(group) + "\n" + scheduleHelp)
+}
+
+// cmdScheduleAdd добавляет окно закрытия на указанные дни недели
+func (t *Telegram) cmdScheduleAdd(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		return ctx.Reply("Пожалуйста, укажите дни и время, например: /schedule_add будни 22:00-09:00")
+	}
+
+	days, err := parseWeekdays(args[0])
+	if err != nil {
+		return ctx.Reply("Некорректные дни недели. Используйте пн, вт, ср, чт, пт, сб, вс, диапазоны (пн-пт), списки (сб,вс) или слова будни, выходные, все")
+	}
+
+	start, end, err := parseWindowRange(args[1])
+	if err != nil {
+		return ctx.Reply("Некорректное время. Используйте формат ЧЧ:ММ-ЧЧ:ММ, например: 22:00-09:00 или 00:00-24:00")
+	}
+
+	windows := make([]database.ScheduleWindow, 0, len(days))
+	for _, day := range days {
+		windows = append(windows, database.ScheduleWindow{
+			ChatID:  group.ChatID,
+			Weekday: day,
+			Start:   start,
+			End:     end,
+		})
+	}
+
+	err = t.db.AddScheduleWindows(windows)
+
+	return t.replySchedule(ctx, "Окно закрытия добавлено", err)
+}
+
+// cmdScheduleRemove удаляет окно закрытия по номеру из /schedule
+func (t *Telegram) cmdScheduleRemove(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) != 1 {
+		return ctx.Reply("Пожалуйста, укажите номер окна из /schedule, например: /schedule_remove 2")
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 1 || index > len(group.ScheduleWindows) {
+		return ctx.Reply("Окно с таким номером не найдено, посмотрите список командой /schedule")
+	}
+
+	deleted, err := t.db.DeleteScheduleWindow(group.ChatID, group.ScheduleWindows[index-1].ID)
+	if err == nil && !deleted {
+		return ctx.Reply("Окно уже удалено, посмотрите список командой /schedule")
+	}
+
+	return t.replySchedule(ctx, "Окно закрытия удалено", err)
+}
+
+// cmdScheduleClear удаляет все окна закрытия. Исключения остаются
+func (t *Telegram) cmdScheduleClear(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	err := t.db.ClearScheduleWindows(group.ChatID)
+
+	return t.replySchedule(ctx, "Все окна закрытия удалены", err)
+}
+
+// cmdHolidayAdd добавляет или заменяет исключение расписания на дату
+func (t *Telegram) cmdHolidayAdd(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) < 1 {
+		return ctx.Reply("Пожалуйста, укажите дату, например: /holiday 2025-01-01 closed Новый год")
+	}
+
+	date, err := time.Parse(scheduleDateLayout, args[0])
+	if err != nil {
+		return ctx.Reply("Некорректная дата. Используйте формат ГГГГ-ММ-ДД, например: 2025-01-01")
+	}
+
+	closed := true
+	noteArgs := args[1:]
+	if len(noteArgs) > 0 {
+		switch strings.ToLower(noteArgs[0]) {
+		case "closed", "закрыт":
+			noteArgs = noteArgs[1:]
+		case "open", "открыт":
+			closed = false
+			noteArgs = noteArgs[1:]
+		}
+	}
+
+	exception := &database.ScheduleException{
+		ChatID: group.ChatID,
+		Date:   date.Format(scheduleDateLayout),
+		Closed: closed,
+		Note:   strings.Join(noteArgs, " "),
+	}
+
+	err = t.db.SaveScheduleException(exception)
+
+	return t.replySchedule(ctx, "Исключение сохранено", err)
+}
+
+// cmdHolidayRemove удаляет исключение расписания на дату
+func (t *Telegram) cmdHolidayRemove(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) != 1 {
+		return ctx.Reply("Пожалуйста, укажите дату, например: /holiday_remove 2025-01-01")
+	}
+
+	deleted, err := t.db.DeleteScheduleException(group.ChatID, args[0])
+	if err == nil && !deleted {
+		return ctx.Reply("Исключение на эту дату не найдено")
+	}
+
+	return t.replySchedule(ctx, "Исключение удалено", err)
+}
@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "00:00", want: 0},
+		{value: "09:00", want: 9 * 60},
+		{value: "22:30", want: 22*60 + 30},
+		{value: "23:59", want: 23*60 + 59},
+		{value: "24:00", wantErr: true},
+		{value: "09:60", wantErr: true},
+		{value: "9:00", wantErr: true},
+		{value: "09:0", wantErr: true},
+		{value: "0900", wantErr: true},
+		{value: " 09:00", wantErr: true},
+		{value: "+9:00", wantErr: true},
+		{value: "ab:cd", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseClock(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseClock(%q) = %d, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseClock(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseClock(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{value: "пн", want: []int{1}},
+		{value: "ПН-ПТ", want: []int{1, 2, 3, 4, 5}},
+		{value: "сб,вс", want: []int{6, 0}},
+		{value: "mon,wed,fri", want: []int{1, 3, 5}},
+		{value: "пт-пн", want: []int{5, 6, 0, 1}},
+		{value: "пн,пн-ср", want: []int{1, 2, 3}},
+		{value: "будни", want: []int{1, 2, 3, 4, 5}},
+		{value: "выходные", want: []int{6, 0}},
+		{value: "все", want: []int{0, 1, 2, 3, 4, 5, 6}},
+		{value: "", wantErr: true},
+		{value: "пн-вт-ср", wantErr: true},
+		{value: "пн-xx", wantErr: true},
+		{value: "monday", wantErr: true},
+		{value: "пн,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWeekdays(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseWeekdays(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseWeekdays(%q) error: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWeekdays(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClosedAtLocal(t *testing.T) {
+	// 19 октября 2026 - понедельник
+	windows := []database.ScheduleWindow{
+		{Weekday: 1, Start: "22:00", End: "09:00"},
+		{Weekday: 3, Start: "18:00", End: "24:00"},
+		{Weekday: 5, Start: "12:00", End: "13:00"},
+	}
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		exceptions []database.ScheduleException
+		local      time.Time
+		want       bool
+	}{
+		{name: "до окна", local: at(19, 21, 59), want: false},
+		{name: "начало окна", local: at(19, 22, 0), want: true},
+		{name: "окно после полуночи", local: at(20, 8, 59), want: true},
+		{name: "конец окна", local: at(20, 9, 0), want: false},
+		{name: "окно до конца суток", local: at(21, 23, 59), want: true},
+		{name: "после окна до конца суток", local: at(22, 0, 0), want: false},
+		{name: "окно внутри дня", local: at(23, 12, 30), want: true},
+		{name: "день без окон", local: at(25, 23, 0), want: false},
+		{
+			name:       "закрытый праздник",
+			exceptions: []database.ScheduleException{{Date: "2026-10-19", Closed: true}},
+			local:      at(19, 12, 0),
+			want:       true,
+		},
+		{
+			name:       "открытый праздник",
+			exceptions: []database.ScheduleException{{Date: "2026-10-19", Closed: false}},
+			local:      at(19, 23, 0),
+			want:       false,
+		},
+		{
+			name:       "утро после открытого праздника",
+			exceptions: []database.ScheduleException{{Date: "2026-10-19", Closed: false}},
+			local:      at(20, 8, 0),
+			want:       false,
+		},
+		{
+			name:       "открытое утро после обычного вечера",
+			exceptions: []database.ScheduleException{{Date: "2026-10-20", Closed: false}},
+			local:      at(20, 8, 0),
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		group := &database.ModeratedGroup{ScheduleWindows: windows, ScheduleExceptions: tt.exceptions}
+		got := closedAtLocal(group, tt.local)
+		if got != tt.want {
+			t.Errorf("%s: closedAtLocal(%s) = %v, want %v", tt.name, tt.local, got, tt.want)
+		}
+	}
+}
+
+func TestNextScheduleChange(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := &Telegram{}
+
+	tests := []struct {
+		name       string
+		timeZone   string
+		windows    []database.ScheduleWindow
+		exceptions []database.ScheduleException
+		now        time.Time
+		want       time.Time
+		wantOK     bool
+	}{
+		{
+			name:    "закрытие вечером",
+			windows: database.DailyScheduleWindows("22:00", "09:00"),
+			now:     time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			want:    time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC),
+			wantOK:  true,
+		},
+		{
+			name:    "открытие после полуночи",
+			windows: database.DailyScheduleWindows("22:00", "09:00"),
+			now:     time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC),
+			want:    time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+			wantOK:  true,
+		},
+		{
+			name:     "часовой пояс группы",
+			timeZone: "Europe/Berlin",
+			windows:  database.DailyScheduleWindows("22:00", "09:00"),
+			now:      time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 19, 22, 0, 0, 0, berlin),
+			wantOK:   true,
+		},
+		{
+			name:       "закрытый праздник продолжается окном",
+			windows:    database.DailyScheduleWindows("22:00", "09:00"),
+			exceptions: []database.ScheduleException{{Date: "2026-10-21", Closed: true}},
+			now:        time.Date(2026, 10, 21, 9, 0, 0, 0, time.UTC),
+			want:       time.Date(2026, 10, 22, 9, 0, 0, 0, time.UTC),
+			wantOK:     true,
+		},
+		{
+			name:       "открытый праздник начинается в полночь",
+			windows:    database.DailyScheduleWindows("22:00", "09:00"),
+			exceptions: []database.ScheduleException{{Date: "2026-10-20", Closed: false}},
+			now:        time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC),
+			want:       time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC),
+			wantOK:     true,
+		},
+		{
+			name:    "окно раз в неделю",
+			windows: []database.ScheduleWindow{{Weekday: 0, Start: "10:00", End: "12:00"}},
+			now:     time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			want:    time.Date(2026, 10, 25, 10, 0, 0, 0, time.UTC),
+			wantOK:  true,
+		},
+		{
+			name:     "начало окна пропущено при переходе на летнее время",
+			timeZone: "Europe/Berlin",
+			windows:  []database.ScheduleWindow{{Weekday: 0, Start: "02:30", End: "05:00"}},
+			now:      time.Date(2026, 3, 28, 12, 0, 0, 0, berlin),
+			want:     time.Date(2026, 3, 29, 3, 0, 0, 0, berlin),
+			wantOK:   true,
+		},
+		{
+			name:     "первое 02:30 при переходе на зимнее время",
+			timeZone: "Europe/Berlin",
+			windows:  []database.ScheduleWindow{{Weekday: 0, Start: "00:00", End: "02:30"}},
+			now:      time.Date(2026, 10, 25, 1, 0, 0, 0, berlin),
+			want:     time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+			wantOK:   true,
+		},
+		{
+			name:     "повторный час при переходе на зимнее время",
+			timeZone: "Europe/Berlin",
+			windows:  []database.ScheduleWindow{{Weekday: 0, Start: "00:00", End: "02:30"}},
+			now:      time.Date(2026, 10, 25, 0, 45, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC),
+			wantOK:   true,
+		},
+		{
+			name:   "пустое расписание",
+			now:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			wantOK: false,
+		},
+		{
+			name:    "закрыт круглые сутки",
+			windows: database.DailyScheduleWindows("00:00", "24:00"),
+			now:     time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			wantOK:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		group := &database.ModeratedGroup{
+			TimeZone:           tt.timeZone,
+			ScheduleWindows:    tt.windows,
+			ScheduleExceptions: tt.exceptions,
+		}
+		got, ok := tg.nextScheduleChange(group, tt.now)
+		if ok != tt.wantOK || (ok && !got.Equal(tt.want)) {
+			t.Errorf("%s: nextScheduleChange(%s) = %s, %v, want %s, %v", tt.name, tt.now, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Имя списка запрещенных слов для перелистывания
+const listStopwords = "stopwords"
+
+// Подсказка по команде /stopword_add
+const stopwordHelp = "Использование: /stopword_add [действие] шаблон\n" +
+	"Действия: delete (по умолчанию), warn, mute:срок, ban[:срок], notify\n" +
+	"Шаблоны: слово или фраза целиком, спам* - с подстановкой, re:выражение - регулярное выражение\n" +
+	"Например: /stopword_add warn казино*\n" +
+	"/stopword_add mute:1h re:заработ\\w+ в интернете"
+
+// setupStopwords регистрирует команды запрещенных слов
+func (t *Telegram) setupStopwords() {
+	t.bot.Handle("/stopword_add", t.cmdStopwordAdd)
+	t.bot.Handle("/stopword_remove", t.cmdStopwordRemove)
+	t.bot.Handle("/stopwords", t.cmdStopwords)
+
+	t.registerList(listStopwords, t.stopwordsList)
+}
+
+// parseStopwordAction разбирает действие вида warn, mute:1h или ban
+func parseStopwordAction(value string) (string, int64, bool) {
+	action, durationStr, _ := strings.Cut(strings.ToLower(value), ":")
+	if _, ok := stopwordActions[action]; !ok {
+		return "", 0, false
+	}
+
+	if durationStr == "" {
+		return action, 0, action != database.SanctionMute
+	}
+	if action != database.SanctionMute && action != database.SanctionBan {
+		return "", 0, false
+	}
+
+	duration, err := parseDuration(durationStr)
+	if err != nil || duration > maxSanctionDuration {
+		return "", 0, false
+	}
+
+	return action, int64(duration / time.Second), true
+}
+
+// cmdStopwordAdd добавляет запрещенное слово или заменяет действие у существующего
+func (t *Telegram) cmdStopwordAdd(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	action, duration := stopwordDelete, int64(0)
+	if len(args) > 1 {
+		if parsed, parsedDuration, ok := parseStopwordAction(args[0]); ok {
+			action, duration = parsed, parsedDuration
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return ctx.Reply(stopwordHelp)
+	}
+
+	stopword, err := parseStopword(strings.Join(args, " "))
+	if err != nil {
+		return ctx.Reply("Некорректный шаблон.\n\n" + stopwordHelp)
+	}
+	stopword.ChatID = group.ChatID
+	stopword.Action = action
+	stopword.Duration = duration
+
+	err = t.db.SaveStopword(&stopword)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+
+	return ctx.Reply("Запрещенное слово добавлено: " + formatStopword(stopword))
+}
+
+// cmdStopwordRemove удаляет запрещенное слово по номеру из /stopwords или по шаблону
+func (t *Telegram) cmdStopwordRemove(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		return ctx.Reply("Пожалуйста, укажите номер из /stopwords или шаблон, например: /stopword_remove 2")
+	}
+
+	index := -1
+	if number, err := strconv.Atoi(args[0]); err == nil && len(args) == 1 {
+		if number >= 1 && number <= len(group.Stopwords) {
+			index = number - 1
+		}
+	} else if stopword, err := parseStopword(strings.Join(args, " ")); err == nil {
+		for i, item := range group.Stopwords {
+			if item.Kind == stopword.Kind && item.Pattern == stopword.Pattern {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return ctx.Reply("Запрещенное слово не найдено, посмотрите список командой /stopwords")
+	}
+
+	removed := group.Stopwords[index]
+	deleted, err := t.db.DeleteStopword(group.ChatID, removed.ID)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+	t.invalidateModeratedGroup(group.ChatID)
+	if !deleted {
+		return ctx.Reply("Запрещенное слово уже удалено, посмотрите список командой /stopwords")
+	}
+
+	return ctx.Reply("Запрещенное слово удалено: " + formatStopword(removed))
+}
+
+// cmdStopwords показывает запрещенные слова группы
+func (t *Telegram) cmdStopwords(ctx tele.Context) error {
+	return t.sendList(ctx, listStopwords)
+}
+
+// stopwordsList собирает запрещенные слова группы для вывода по страницам
+func (t *Telegram) stopwordsList(ctx tele.Context, _ []string) (string, []string, error) {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	items := make([]string, 0, len(group.Stopwords))
+	for _, stopword := range group.Stopwords {
+		items = append(items, formatStopword(stopword))
+	}
+
+	return "Запрещенные слова. Добавить: /stopword_add, удалить: /stopword_remove номер", items, nil
+}
+
+// moderateStopwords применяет действие запрещенного слова, найденного в сообщении.
+// Возвращает true, если сообщение удалено и дальше проверять его не нужно
+func (t *Telegram) moderateStopwords(ctx tele.Context, group *database.ModeratedGroup) bool {
+	msg := ctx.Message()
+	stopword, found := findStopword(msg, group)
+	if !found {
+		return false
+	}
+
+	zap.L().Debug("Найдено запрещенное слово",
+		zap.Int64("chat_id", msg.Chat.ID),
+		zap.String("pattern", stopword.Pattern),
+		zap.String("action", stopword.Action))
+
+	if stopword.Action == stopwordNotify {
+		text := fmt.Sprintf("В чате %s %s написал запрещенное слово (%s)", msg.Chat.Title, formatUser(ctx.Sender()), stopword.Pattern)
+		if link := messageLink(msg); link != "" {
+			text += "\n" + link
+		}
+		t.notifyAdmins(msg.Chat, text)
+		t.logAction(&database.ModerationAction{
+			ChatID:   msg.Chat.ID,
+			TargetID: ctx.Sender().ID,
+			Action:   actionNotify,
+			Rule:     "запрещенное слово: " + formatStopword(*stopword),
+			Excerpt:  messageExcerpt(msg),
+		})
+		return false
+	}
+
+	err := t.deleteMessage(msg)
+	if err != nil {
+		zap.L().Error("Не удалось удалить сообщение", zap.Error(err))
+		return true
+	}
+
+	// За один альбом наказываем один раз
+	if !t.firstAlbumViolation(msg) {
+		return true
+	}
+
+	rule := "запрещенное слово: " + formatStopword(*stopword)
+	t.logAction(&database.ModerationAction{
+		ChatID:   msg.Chat.ID,
+		TargetID: ctx.Sender().ID,
+		Action:   actionDelete,
+		Rule:     rule,
+		Excerpt:  messageExcerpt(msg),
+	})
+
+	notice := "Ваше сообщение было удалено, так как оно содержит запрещенные слова."
+	switch stopword.Action {
+	case stopwordWarn:
+		result, err := t.warnUser(group, msg.Chat, ctx.Sender(), 0, "запрещенное слово: "+stopword.Pattern)
+		if err != nil {
+			zap.L().Error("Не удалось выдать предупреждение", zap.Error(err))
+		} else {
+			notice += "\n\n" + result.String()
+		}
+	case database.SanctionMute, database.SanctionBan:
+		duration := time.Duration(stopword.Duration) * time.Second
+		err = t.applySanction(msg.Chat, ctx.Sender(), stopword.Action, duration)
+		if err != nil {
+			zap.L().Error("Не удалось применить наказание", zap.Error(err), zap.Int64("chat_id", msg.Chat.ID))
+		} else {
+			notice += "\nНаказание: " + formatSanction(stopword.Action, duration)
+			t.logAction(&database.ModerationAction{
+				ChatID:   msg.Chat.ID,
+				TargetID: ctx.Sender().ID,
+				Action:   stopword.Action,
+				Duration: stopword.Duration,
+				Rule:     rule,
+			})
+		}
+	}
+
+	// Уведомляем пользователя (в личку)
+	_, _ = t.bot.Send(&tele.User{ID: ctx.Sender().ID}, notice)
+
+	return true
+}
+
+// notifyAdmins отправляет сообщение в личку всем администраторам чата, кроме ботов, и возвращает,
+// сколько администраторов его получили. Те, кто не начинал диалог с ботом, сообщение не получат
+func (t *Telegram) notifyAdmins(chat *tele.Chat, text string) int {
+	admins, err := t.chatAdmins(chat)
+	if err != nil {
+		zap.L().Error("Не удалось получить список администраторов", zap.Error(err))
+		return 0
+	}
+
+	sent := 0
+	for _, admin := range admins {
+		if admin.User == nil || admin.User.IsBot {
+			continue
+		}
+		_, err = t.bot.Send(admin.User, text)
+		if err != nil {
+			zap.L().Debug("Не удалось уведомить администратора", zap.Error(err), zap.Int64("user_id", admin.User.ID))
+			continue
+		}
+		sent++
+	}
+
+	return sent
+}
+
+// messageLink возвращает ссылку на сообщение. Для обычных групп ссылок нет
+func messageLink(msg *tele.Message) string {
+	if msg.Chat.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", msg.Chat.Username, msg.ID)
+	}
+	if msg.Chat.Type == tele.ChatSuperGroup {
+		id := strings.TrimPrefix(strconv.FormatInt(msg.Chat.ID, 10), "-100")
+		return fmt.Sprintf("https://t.me/c/%s/%d", id, msg.ID)
+	}
+
+	return ""
+}
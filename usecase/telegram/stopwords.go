@@ -0,0 +1,192 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Типы запрещенных слов
+const (
+	stopwordPlain    = "plain"    // слово или фраза целиком
+	stopwordWildcard = "wildcard" // шаблон с * (любые буквы) и ? (один символ)
+	stopwordRegexp   = "regexp"   // регулярное выражение
+)
+
+// Действия при нахождении запрещенного слова. mute и ban совпадают с наказаниями
+const (
+	stopwordDelete = "delete" // удалить сообщение
+	stopwordWarn   = "warn"   // удалить и выдать предупреждение
+	stopwordNotify = "notify" // только сообщить администраторам
+)
+
+// Описания действий для команд
+var stopwordActions = map[string]string{
+	stopwordDelete:        "удалить",
+	stopwordWarn:          "удалить и предупредить",
+	database.SanctionMute: "удалить и замутить",
+	database.SanctionBan:  "удалить и забанить",
+	stopwordNotify:        "сообщить администраторам",
+}
+
+// Символы нулевой ширины и мягкий перенос, которыми разбивают слова, чтобы обойти фильтр
+var invisibleRunes = map[rune]bool{
+	'\u00ad': true, '\u034f': true, '\u180e': true, '\u200b': true, '\u200c': true,
+	'\u200d': true, '\u200e': true, '\u200f': true, '\u2060': true, '\u2061': true,
+	'\u2062': true, '\u2063': true, '\u2064': true, '\ufeff': true,
+}
+
+// Буквы, похожие на латинские, приводятся к латинским. Таблица применяется после перевода
+// в нижний регистр, поэтому в нее входят и буквы, похожие только заглавными (В - B, Н - H)
+var homoglyphs = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'ο': 'o', 'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+}
+
+// Скомпилированные шаблоны запрещенных слов, чтобы не компилировать их на каждое сообщение
+var stopwordCache sync.Map
+
+// normalizeText приводит текст к виду для сравнения: убирает невидимые символы и диакритику,
+// заменяет похожие буквы латинскими, полноширинные символы обычными и переводит в нижний регистр
+func normalizeText(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+
+	for _, r := range text {
+		if invisibleRunes[r] || unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		// Полноширинные латинские буквы и цифры
+		if r >= '！' && r <= '～' {
+			r = r - '！' + '!'
+		}
+		r = unicode.ToLower(r)
+		if mapped, ok := homoglyphs[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// parseStopword разбирает шаблон запрещенного слова: re:выражение или /выражение/ - регулярное выражение,
+// шаблоны со * или ? - wildcard, остальное - слово или фраза целиком
+func parseStopword(value string) (database.Stopword, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return database.Stopword{}, fmt.Errorf("empty stopword")
+	}
+
+	stopword := database.Stopword{Kind: stopwordPlain, Pattern: value}
+	switch {
+	case strings.HasPrefix(strings.ToLower(value), "re:"):
+		stopword.Kind, stopword.Pattern = stopwordRegexp, value[3:]
+	case len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+		stopword.Kind, stopword.Pattern = stopwordRegexp, value[1:len(value)-1]
+	case strings.ContainsAny(value, "*?"):
+		stopword.Kind = stopwordWildcard
+	}
+
+	_, err := compileStopword(stopword)
+	if err != nil {
+		return database.Stopword{}, err
+	}
+
+	return stopword, nil
+}
+
+// compileStopword строит регулярное выражение для запрещенного слова. Слова и wildcard-шаблоны
+// нормализуются так же, как текст сообщения, и совпадают только целыми словами
+func compileStopword(stopword database.Stopword) (*regexp.Regexp, error) {
+	cacheKey := stopword.Kind + ":" + stopword.Pattern
+	if re, ok := stopwordCache.Load(cacheKey); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	var expr string
+	switch stopword.Kind {
+	case stopwordRegexp:
+		expr = "(?i)" + stopword.Pattern
+	case stopwordWildcard:
+		var b strings.Builder
+		for _, r := range normalizeText(stopword.Pattern) {
+			switch r {
+			case '*':
+				b.WriteString(`[\pL\pN]*`)
+			case '?':
+				b.WriteString(`[\pL\pN]`)
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		expr = `(?:^|[^\pL\pN])` + b.String() + `(?:$|[^\pL\pN])`
+	default:
+		words := strings.Fields(normalizeText(stopword.Pattern))
+		for i := range words {
+			words[i] = regexp.QuoteMeta(words[i])
+		}
+		expr = `(?:^|[^\pL\pN])` + strings.Join(words, `\s+`) + `(?:$|[^\pL\pN])`
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	stopwordCache.Store(cacheKey, re)
+
+	return re, nil
+}
+
+// findStopword ищет в сообщении первое запрещенное слово группы. Регулярные выражения
+// проверяются и по исходному, и по нормализованному тексту, остальные шаблоны - по нормализованному
+func findStopword(msg *tele.Message, group *database.ModeratedGroup) (*database.Stopword, bool) {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	if text == "" || len(group.Stopwords) == 0 {
+		return nil, false
+	}
+
+	normalized := normalizeText(text)
+	for i := range group.Stopwords {
+		stopword := &group.Stopwords[i]
+		re, err := compileStopword(*stopword)
+		if err != nil {
+			continue
+		}
+
+		if re.MatchString(normalized) {
+			return stopword, true
+		}
+		if stopword.Kind == stopwordRegexp && re.MatchString(text) {
+			return stopword, true
+		}
+	}
+
+	return nil, false
+}
+
+// formatStopword выводит запрещенное слово с действием
+func formatStopword(stopword database.Stopword) string {
+	pattern := stopword.Pattern
+	if stopword.Kind == stopwordRegexp {
+		pattern = "re:" + pattern
+	}
+
+	action := stopwordActions[stopword.Action]
+	if stopword.Action == database.SanctionMute || stopword.Action == database.SanctionBan {
+		action = "удалить, " + formatSanction(stopword.Action, time.Duration(stopword.Duration)*time.Second)
+	}
+
+	return fmt.Sprintf("%s - %s", pattern, action)
+}
@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Casino", want: "casino"},
+		{text: "саsinо", want: "casino"},
+		{text: "СКАМ", want: "ckam"},
+		{text: "ca\u200bsi\u00adno", want: "casino"},
+		{text: "cafe\u0301", want: "cafe"},
+		{text: "ＣＡＳＩＮＯ１", want: "casino1"},
+		{text: "ναι", want: "vai"},
+		{text: "привет мир", want: "пpиbet mиp"},
+	}
+
+	for _, tt := range tests {
+		got := normalizeText(tt.text)
+		if got != tt.want {
+			t.Errorf("normalizeText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseStopword(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    database.Stopword
+		wantErr bool
+	}{
+		{value: "casino", want: database.Stopword{Kind: stopwordPlain, Pattern: "casino"}},
+		{value: "  free money ", want: database.Stopword{Kind: stopwordPlain, Pattern: "free money"}},
+		{value: "cas*no", want: database.Stopword{Kind: stopwordWildcard, Pattern: "cas*no"}},
+		{value: "bet?", want: database.Stopword{Kind: stopwordWildcard, Pattern: "bet?"}},
+		{value: "re:^spam", want: database.Stopword{Kind: stopwordRegexp, Pattern: "^spam"}},
+		{value: "RE:spam", want: database.Stopword{Kind: stopwordRegexp, Pattern: "spam"}},
+		{value: "/sp[a4]m/", want: database.Stopword{Kind: stopwordRegexp, Pattern: "sp[a4]m"}},
+		{value: "", wantErr: true},
+		{value: "   ", wantErr: true},
+		{value: "re:(", wantErr: true},
+		{value: "/[/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseStopword(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseStopword(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStopword(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStopword(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompileStopword(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+		text    string
+		want    bool
+	}{
+		{kind: stopwordPlain, pattern: "casino", text: "best casino here", want: true},
+		{kind: stopwordPlain, pattern: "casino", text: "Best CASINO!", want: true},
+		{kind: stopwordPlain, pattern: "casino", text: "саsinо", want: true},
+		{kind: stopwordPlain, pattern: "casino", text: "ca\u200bsino", want: true},
+		{kind: stopwordPlain, pattern: "casino", text: "casinos", want: false},
+		{kind: stopwordPlain, pattern: "casino", text: "megacasino", want: false},
+		{kind: stopwordPlain, pattern: "free money", text: "get free   money now", want: true},
+		{kind: stopwordPlain, pattern: "free money", text: "free and money", want: false},
+		{kind: stopwordPlain, pattern: "a.b", text: "axb", want: false},
+		{kind: stopwordPlain, pattern: "скам", text: "это СКАМ", want: true},
+		{kind: stopwordWildcard, pattern: "cas*no", text: "cassssino", want: true},
+		{kind: stopwordWildcard, pattern: "cas*no", text: "casno", want: true},
+		{kind: stopwordWildcard, pattern: "cas*no", text: "cas no", want: false},
+		{kind: stopwordWildcard, pattern: "bet?", text: "bets", want: true},
+		{kind: stopwordWildcard, pattern: "bet?", text: "bet", want: false},
+		{kind: stopwordWildcard, pattern: "bet?", text: "betss", want: false},
+		{kind: stopwordRegexp, pattern: "sp[a4]m", text: "SP4M", want: true},
+		{kind: stopwordRegexp, pattern: "^spam$", text: "not spam", want: false},
+	}
+
+	for _, tt := range tests {
+		re, err := compileStopword(database.Stopword{Kind: tt.kind, Pattern: tt.pattern})
+		if err != nil {
+			t.Errorf("compileStopword(%s %q) error: %v", tt.kind, tt.pattern, err)
+			continue
+		}
+		got := re.MatchString(normalizeText(tt.text))
+		if got != tt.want {
+			t.Errorf("stopword %s %q on %q = %v, want %v", tt.kind, tt.pattern, tt.text, got, tt.want)
+		}
+	}
+}
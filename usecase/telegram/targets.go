@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v4"
+)
+
+// Ошибки поиска пользователя, к которому относится команда. Текст показывается пользователю
+var (
+	errTargetMissing  = errors.New("Укажите пользователя: ответьте на его сообщение или передайте @username или ID")
+	errTargetNotFound = errors.New("Пользователь не найден. Бот знает только тех, кто уже писал в чатах с ним, попробуйте ответить на сообщение пользователя или указать ID")
+)
+
+// repliedMessage возвращает сообщение, на которое ответили командой. В темах форума каждое сообщение
+// отвечает на служебное сообщение о создании темы, такой ответ не считается
+func repliedMessage(msg *tele.Message) *tele.Message {
+	if msg == nil || msg.ReplyTo == nil {
+		return nil
+	}
+	if msg.ReplyTo.TopicCreated != nil || (msg.TopicMessage && msg.ReplyTo.ID == msg.ThreadID) {
+		return nil
+	}
+
+	return msg.ReplyTo
+}
+
+// resolveTarget определяет пользователя, к которому относится команда: автор сообщения,
+// на которое ответили командой, упомянутый в команде пользователь, @username или числовой ID.
+// Возвращает пользователя и оставшиеся аргументы команды
+func (t *Telegram) resolveTarget(ctx tele.Context) (*tele.User, []string, error) {
+	msg := ctx.Message()
+	args := ctx.Args()
+
+	if reply := repliedMessage(msg); reply != nil && reply.Sender != nil && reply.SenderChat == nil {
+		return reply.Sender, args, nil
+	}
+
+	if len(args) == 0 {
+		return nil, nil, errTargetMissing
+	}
+
+	// Упоминание пользователя без юзернейма приходит с самим пользователем в разметке
+	if msg != nil {
+		payload := strings.TrimSpace(msg.Payload)
+		for _, entity := range msg.Entities {
+			name := msg.EntityText(entity)
+			if entity.Type == tele.EntityTMention && entity.User != nil && strings.HasPrefix(payload, name) {
+				return entity.User, strings.Fields(strings.TrimPrefix(payload, name)), nil
+			}
+		}
+	}
+
+	if strings.HasPrefix(args[0], "@") {
+		user, err := t.db.GetUserByUsername(strings.TrimPrefix(args[0], "@"))
+		if err != nil {
+			return nil, nil, errTargetNotFound
+		}
+
+		return &tele.User{
+			ID:        user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Username:  user.Username,
+		}, args[1:], nil
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return nil, nil, errTargetMissing
+	}
+
+	user := &tele.User{ID: id}
+	if ctx.Chat() != nil {
+		member, err := t.bot.ChatMemberOf(ctx.Chat(), user)
+		if err == nil && member.User != nil {
+			user = member.User
+		}
+	}
+
+	return user, args[1:], nil
+}
+
+// formatUser выводит пользователя в виде "Имя (@username, ID)"
+func formatUser(user *tele.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.Username != "" {
+		if name == "" {
+			return fmt.Sprintf("@%s (%d)", user.Username, user.ID)
+		}
+		return fmt.Sprintf("%s (@%s, %d)", name, user.Username, user.ID)
+	}
+	if name != "" {
+		return fmt.Sprintf("%s (%d)", name, user.ID)
+	}
+
+	return strconv.FormatInt(user.ID, 10)
+}
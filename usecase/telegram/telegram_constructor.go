@@ -5,8 +5,8 @@ import (
 	"app/gateway/database"
 	"app/gateway/redis"
 	"context"
+	"go.uber.org/zap"
 	tele "gopkg.in/telebot.v4"
-	"gopkg.in/telebot.v4/middleware"
 )
 
 type Telegram struct {
@@ -14,6 +14,15 @@ type Telegram struct {
 	redis  *redis.Redis
 	db     *database.Database
 	bot    *tele.Bot
+
+	// Списки, которые можно листать кнопками, по имени
+	lists map[string]listProvider
+
+	// Отправители, которых еще нужно записать в базу
+	users *userBuffer
+
+	// Проверка прав пользователей
+	auth *authorizer
 }
 
 func NewTelegram(
@@ -22,21 +31,56 @@ func NewTelegram(
 	redis *redis.Redis,
 	bot *tele.Bot,
 ) (*Telegram, error) {
-	return &Telegram{
+	t := &Telegram{
 		config: config,
 		db:     db,
 		redis:  redis,
 		bot:    bot,
-	}, nil
+		users:  newUserBuffer(),
+	}
+	t.auth = newAuthorizer(config.Owners, db, redis, t.chatAdmins)
+
+	return t, nil
 }
 
-func (t *Telegram) Run(ctx context.Context) error {
-	adminOnly := t.bot.Group()
-	adminOnly.Use(middleware.Whitelist(dto.GlobalAdminID))
-	adminOnly.Handle("/ban", t.cmdBan)
+// Setup переносит старые данные из редиса и регистрирует обработчики. Вызывается до запуска поллинга:
+// карта обработчиков телебота не защищена от одновременного доступа, а обновления без обработчика теряются
+func (t *Telegram) Setup() error {
+	if len(t.config.Owners) == 0 {
+		zap.L().Warn("В конфиге не указаны владельцы бота, глобальные команды доступны только суперадминистраторам из базы")
+	}
+
+	err := t.importRedisModeratedGroups()
+	if err != nil {
+		return err
+	}
+
+	err = t.typeLegacyWhitelistedLinks()
+	if err != nil {
+		return err
+	}
+
+	err = t.importRedisGlobalWhitelist()
+	if err != nil {
+		return err
+	}
+
+	// Учет пользователей, чатов и участников и модерация сообщений нужны для всех обработчиков,
+	// поэтому подключаются до них
+	t.bot.Use(t.trackUsers, t.trackMembership, t.moderation)
+	t.bot.Poller = tele.NewMiddlewarePoller(t.bot.Poller, t.catchPolls)
+	t.bot.Handle(tele.OnUserLeft, t.onUserLeft)
 
 	t.bot.Handle("/start", t.cmdStart)
 	t.bot.Handle("/stats", t.cmdCountUsers)
 
+	t.setupPagination()
+	t.setupModeration()
+
 	return nil
 }
+
+// Run запускает планировщик модерации до остановки приложения
+func (t *Telegram) Run(ctx context.Context) error {
+	return t.scheduleModeration(ctx)
+}
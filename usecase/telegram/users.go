@@ -0,0 +1,166 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Пользователи копятся в памяти и записываются в базу пачкой, а не на каждое сообщение.
+// При переполнении буфера запись выполняется раньше срока
+const (
+	usersFlushInterval = 10 * time.Second
+	usersBufferSize    = 500
+)
+
+// Имя истории имен пользователя для перелистывания
+const listNames = "names"
+
+// userBuffer последние данные отправителей, еще не записанные в базу
+type userBuffer struct {
+	mu      sync.Mutex
+	pending map[int64]database.User
+	full    chan struct{} // сигнал планировщику записать буфер досрочно
+}
+
+func newUserBuffer() *userBuffer {
+	return &userBuffer{
+		pending: map[int64]database.User{},
+		full:    make(chan struct{}, 1),
+	}
+}
+
+// add запоминает пользователя. Из нескольких обновлений одного пользователя остается последнее
+func (b *userBuffer) add(user *tele.User, at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending[user.ID] = database.User{
+		ID:           user.ID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Username:     user.Username,
+		LanguageCode: user.LanguageCode,
+		IsBot:        user.IsBot,
+		IsPremium:    user.IsPremium,
+		LastSeenAt:   &at,
+	}
+
+	if len(b.pending) >= usersBufferSize {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take забирает накопленных пользователей и очищает буфер
+func (b *userBuffer) take() []database.User {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	users := make([]database.User, 0, len(b.pending))
+	for _, user := range b.pending {
+		users = append(users, user)
+	}
+	b.pending = map[int64]database.User{}
+
+	return users
+}
+
+// trackUsers middleware, которое запоминает отправителя каждого обновления. Сообщения от имени
+// канала или анонимного администратора приходят от служебного бота, он не запоминается
+func (t *Telegram) trackUsers(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(ctx tele.Context) error {
+		sender := ctx.Sender()
+		if msg := ctx.Message(); msg != nil && msg.SenderChat != nil {
+			sender = nil
+		}
+		if sender != nil {
+			t.users.add(sender, time.Now())
+		}
+
+		return next(ctx)
+	}
+}
+
+// flushUsers записывает накопленных пользователей в базу. При ошибке данные не возвращаются в буфер:
+// те же пользователи придут со следующими сообщениями
+func (t *Telegram) flushUsers() {
+	users := t.users.take()
+	if len(users) == 0 {
+		return
+	}
+
+	err := t.db.SaveUsers(users)
+	if err != nil {
+		zap.L().Error("Не удалось сохранить пользователей", zap.Error(err), zap.Int("count", len(users)))
+	}
+}
+
+// setupUsers регистрирует команду истории имен
+func (t *Telegram) setupUsers() {
+	t.bot.Handle("/names", t.cmdNames)
+
+	t.registerList(listNames, t.namesList)
+}
+
+// cmdNames показывает, под какими именами и юзернеймами бот видел участника
+func (t *Telegram) cmdNames(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	user, _, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	return t.sendList(ctx, listNames, strconv.FormatInt(user.ID, 10))
+}
+
+// namesList собирает историю имен участника для вывода по страницам
+func (t *Telegram) namesList(ctx tele.Context, params []string) (string, []string, error) {
+	group, err := t.adminGroup(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(params) != 1 {
+		return "", nil, errors.New("Использование: /names ответом на сообщение, @username или ID")
+	}
+
+	userID, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		return "", nil, errors.New("Некорректный ID пользователя")
+	}
+
+	// Изменения имени могли еще не попасть в базу
+	t.flushUsers()
+
+	history, err := t.db.GetUserNameHistory(userID)
+	if err != nil {
+		zap.L().Error("Не удалось получить историю имен", zap.Error(err), zap.Int64("user_id", userID))
+		return "", nil, errors.New("Ошибка при получении истории имен")
+	}
+
+	loc := t.groupLocation(group)
+	items := make([]string, 0, len(history))
+	for _, entry := range history {
+		name := strings.TrimSpace(entry.FirstName + " " + entry.LastName)
+		if entry.Username != "" {
+			name += " @" + entry.Username
+		}
+		items = append(items, entry.ChangedAt.In(loc).Format(modlogEntryLayout)+" | "+name)
+	}
+
+	title := "История имен, новые первыми\nУчастник: " + formatUser(t.knownUsers([]int64{userID})[userID])
+
+	return title, items, nil
+}
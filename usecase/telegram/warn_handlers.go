@@ -0,0 +1,235 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// Подсказка по настройкам предупреждений
+const warnSettingsHelp = "Изменить настройки:\n" +
+	"/warn_settings expire 30d - через сколько предупреждения сгорают, 0 - никогда\n" +
+	"/warn_settings ladder 3=mute:1h 5=kick 7=ban - лестница наказаний\n" +
+	"/warn_settings ladder off - без наказаний, default - лестница по умолчанию"
+
+// setupWarnings регистрирует команды предупреждений
+func (t *Telegram) setupWarnings() {
+	t.bot.Handle("/warn", t.cmdWarn)
+	t.bot.Handle("/unwarn", t.cmdUnwarn)
+	t.bot.Handle("/warns", t.cmdWarns)
+	t.bot.Handle("/warn_settings", t.cmdWarnSettings)
+}
+
+// cmdWarn выдает предупреждение участнику: /warn [@username|ID] [причина] или ответом на сообщение.
+// Наказание по лестнице применяется, только если у выдавшего есть право ограничивать участников
+func (t *Telegram) cmdWarn(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	user, args, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	if t.auth.isAdmin(ctx.Chat(), user) {
+		return ctx.Reply("Нельзя выдать предупреждение администратору")
+	}
+
+	reason := strings.Join(args, " ")
+	result, err := t.warnUser(group, ctx.Chat(), user, ctx.Sender().ID, reason)
+	if err != nil {
+		zap.L().Error("Не удалось выдать предупреждение", zap.Error(err))
+		return ctx.Reply("Ошибка при выдаче предупреждения")
+	}
+
+	text := fmt.Sprintf("%s получает предупреждение", formatUser(user))
+	if reason != "" {
+		text += "\nПричина: " + reason
+	}
+
+	return ctx.Reply(text + "\n" + result.String())
+}
+
+// cmdUnwarn снимает последнее предупреждение участника, а с аргументом all - все активные
+func (t *Telegram) cmdUnwarn(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	user, args, err := t.resolveTarget(ctx)
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	now := time.Now()
+	if len(args) > 0 && (strings.EqualFold(args[0], "all") || strings.EqualFold(args[0], "все")) {
+		removed, err := t.db.DeleteActiveWarnings(ctx.Chat().ID, user.ID, now)
+		if err != nil {
+			zap.L().Error("Не удалось снять предупреждения", zap.Error(err))
+			return ctx.Reply("Ошибка при снятии предупреждений")
+		}
+		if removed > 0 {
+			t.logAction(&database.ModerationAction{
+				ChatID:   ctx.Chat().ID,
+				TargetID: user.ID,
+				ActorID:  ctx.Sender().ID,
+				Action:   actionUnwarn,
+				Reason:   fmt.Sprintf("снято предупреждений: %d", removed),
+			})
+		}
+
+		return ctx.Reply(fmt.Sprintf("С %s снято предупреждений: %d", formatUser(user), removed))
+	}
+
+	removed, err := t.db.DeleteLastWarning(ctx.Chat().ID, user.ID, now)
+	if err != nil {
+		zap.L().Error("Не удалось снять предупреждение", zap.Error(err))
+		return ctx.Reply("Ошибка при снятии предупреждения")
+	}
+	if !removed {
+		return ctx.Reply(fmt.Sprintf("У %s нет активных предупреждений", formatUser(user)))
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   ctx.Chat().ID,
+		TargetID: user.ID,
+		ActorID:  ctx.Sender().ID,
+		Action:   actionUnwarn,
+		Reason:   "снято последнее предупреждение",
+	})
+
+	count, err := t.db.CountActiveWarnings(ctx.Chat().ID, user.ID, now)
+	if err != nil {
+		zap.L().Error("Не удалось посчитать предупреждения", zap.Error(err))
+	}
+
+	return ctx.Reply(fmt.Sprintf("С %s снято последнее предупреждение. Активных предупреждений: %d", formatUser(user), count))
+}
+
+// cmdWarns показывает активные предупреждения. Администраторы могут смотреть любого участника,
+// остальные - только свои
+func (t *Telegram) cmdWarns(ctx tele.Context) error {
+	if !isGroupChat(ctx.Chat()) {
+		return ctx.Reply(errGroupOnly.Error())
+	}
+
+	user := ctx.Sender()
+	if t.auth.isAdmin(ctx.Chat(), ctx.Sender()) {
+		target, _, err := t.resolveTarget(ctx)
+		if err != nil && !errors.Is(err, errTargetMissing) {
+			return ctx.Reply(err.Error())
+		}
+		if target != nil {
+			user = target
+		}
+	}
+
+	warnings, err := t.db.GetActiveWarnings(ctx.Chat().ID, user.ID, time.Now())
+	if err != nil {
+		zap.L().Error("Не удалось получить предупреждения", zap.Error(err))
+		return ctx.Reply("Ошибка при получении предупреждений")
+	}
+
+	if len(warnings) == 0 {
+		return ctx.Reply(fmt.Sprintf("У %s нет активных предупреждений", formatUser(user)))
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Активные предупреждения %s:\n\n", formatUser(user)))
+	for i, warning := range warnings {
+		reason := warning.Reason
+		if reason == "" {
+			reason = "без причины"
+		}
+		line := fmt.Sprintf("%d. %s - %s", i+1, warning.CreatedAt.Format("2006-01-02 15:04"), reason)
+		if warning.ExpiresAt != nil {
+			line += ", сгорит " + warning.ExpiresAt.Format("2006-01-02")
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return ctx.Reply(b.String())
+}
+
+// cmdWarnSettings показывает и меняет срок действия предупреждений и лестницу наказаний
+func (t *Telegram) cmdWarnSettings(ctx tele.Context) error {
+	group := t.loadAdminGroup(ctx)
+	if group == nil {
+		return nil
+	}
+
+	args := ctx.Args()
+	if len(args) == 0 {
+		expire := "никогда"
+		if group.WarnExpireHours > 0 {
+			expire = "через " + formatDuration(time.Duration(group.WarnExpireHours)*time.Hour)
+		}
+
+		return ctx.Reply(fmt.Sprintf("Предупреждения сгорают: %s\n\nЛестница наказаний:\n%s\n%s",
+			expire, formatWarnLadder(groupWarnLadder(group)), warnSettingsHelp))
+	}
+
+	var column string
+	switch strings.ToLower(args[0]) {
+	case "expire":
+		column = "WarnExpireHours"
+		if len(args) != 2 {
+			return ctx.Reply(warnSettingsHelp)
+		}
+		if args[1] == "0" {
+			group.WarnExpireHours = 0
+			break
+		}
+		duration, err := parseDuration(args[1])
+		if err != nil || duration < time.Hour {
+			return ctx.Reply("Некорректный срок. Используйте часы, дни или недели, например: 12h, 30d, 2w")
+		}
+		group.WarnExpireHours = int(duration / time.Hour)
+	case "ladder":
+		column = "WarnLadder"
+		if len(args) < 2 {
+			return ctx.Reply(warnSettingsHelp)
+		}
+
+		// Лестница решает, как наказывать, поэтому менять ее могут только те, кто может наказывать сам
+		allowed, err := t.auth.canRestrict(ctx.Chat(), ctx.Sender())
+		if err != nil {
+			zap.L().Error("Не удалось проверить права участника", zap.Error(err))
+		}
+		if !allowed {
+			return ctx.Reply(errNoRestrictRights.Error())
+		}
+
+		switch strings.ToLower(args[1]) {
+		case "off":
+			group.WarnLadder = []database.WarnStep{}
+		case "default":
+			group.WarnLadder = database.DefaultWarnLadder()
+		default:
+			ladder, err := parseWarnLadder(args[1:])
+			if err != nil {
+				return ctx.Reply("Некорректная лестница. Используйте формат количество=наказание[:срок], " +
+					"где наказание - mute, kick или ban, например: 3=mute:1h 5=kick 7=ban:30d")
+			}
+			group.WarnLadder = ladder
+		}
+	default:
+		return ctx.Reply(warnSettingsHelp)
+	}
+
+	err := t.saveModeratedGroup(group, column)
+	if err != nil {
+		zap.L().Error("Не удалось обновить настройки группы", zap.Error(err))
+		return ctx.Reply("Ошибка при обновлении настроек")
+	}
+
+	return ctx.Reply("Настройки предупреждений обновлены")
+}
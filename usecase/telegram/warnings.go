@@ -0,0 +1,202 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v4"
+)
+
+// groupWarnLadder возвращает лестницу наказаний группы. Если она не настраивалась - лестницу по умолчанию
+func groupWarnLadder(group *database.ModeratedGroup) []database.WarnStep {
+	if group.WarnLadder == nil {
+		return database.DefaultWarnLadder()
+	}
+
+	return group.WarnLadder
+}
+
+// warnStepFor ищет ступень лестницы для количества предупреждений. Каждая ступень срабатывает
+// ровно на своем количестве, а все, что выше последней ступени, наказывается как последняя
+func warnStepFor(ladder []database.WarnStep, count int) (database.WarnStep, bool) {
+	if len(ladder) == 0 {
+		return database.WarnStep{}, false
+	}
+
+	for _, step := range ladder {
+		if step.Count == count {
+			return step, true
+		}
+	}
+
+	last := ladder[len(ladder)-1]
+	if count > last.Count {
+		return last, true
+	}
+
+	return database.WarnStep{}, false
+}
+
+// warnResult итог выдачи предупреждения
+type warnResult struct {
+	Count     int64              // сколько теперь активных предупреждений
+	Step      *database.WarnStep // примененная ступень лестницы, если есть
+	StepError error              // ошибка применения наказания
+	Forbidden bool               // наказание не применено: у выдавшего предупреждение нет права ограничивать
+}
+
+// String описывает итог предупреждения для сообщения в чате
+func (r warnResult) String() string {
+	text := fmt.Sprintf("Активных предупреждений: %d", r.Count)
+	if r.Step == nil {
+		return text
+	}
+
+	sanction := formatSanction(r.Step.Action, time.Duration(r.Step.Duration)*time.Second)
+	if r.Forbidden {
+		return text + fmt.Sprintf("\nНаказание (%s) не применено: у выдавшего предупреждение нет права ограничивать участников", sanction)
+	}
+	if r.StepError != nil {
+		return text + fmt.Sprintf("\nНе удалось применить наказание (%s), проверьте права бота", sanction)
+	}
+
+	return text + "\nНаказание: " + sanction
+}
+
+// warnUser выдает участнику предупреждение и применяет ступень лестницы наказаний, если она достигнута.
+// actorID - кто выдал предупреждение, 0 - автоматическая модерация
+func (t *Telegram) warnUser(group *database.ModeratedGroup, chat *tele.Chat, user *tele.User, actorID int64, reason string) (warnResult, error) {
+	now := time.Now()
+	warning := &database.Warning{
+		ChatID:  chat.ID,
+		UserID:  user.ID,
+		ActorID: actorID,
+		Reason:  reason,
+	}
+	if group.WarnExpireHours > 0 {
+		expires := now.Add(time.Duration(group.WarnExpireHours) * time.Hour)
+		warning.ExpiresAt = &expires
+	}
+
+	err := t.db.AddWarning(warning)
+	if err != nil {
+		return warnResult{}, err
+	}
+
+	t.logAction(&database.ModerationAction{
+		ChatID:   chat.ID,
+		TargetID: user.ID,
+		ActorID:  actorID,
+		Action:   actionWarn,
+		Reason:   reason,
+	})
+
+	count, err := t.db.CountActiveWarnings(chat.ID, user.ID, now)
+	if err != nil {
+		return warnResult{}, err
+	}
+
+	result := warnResult{Count: count}
+	step, ok := warnStepFor(groupWarnLadder(group), int(count))
+	if !ok {
+		return result, nil
+	}
+
+	result.Step = &step
+
+	// Модератор без права блокировки может предупреждать, но наказание по лестнице за него не выносится
+	if actorID != 0 {
+		allowed, err := t.auth.canRestrict(chat, &tele.User{ID: actorID})
+		if err != nil {
+			zap.L().Error("Не удалось проверить права участника", zap.Error(err), zap.Int64("chat_id", chat.ID))
+		}
+		if !allowed {
+			result.Forbidden = true
+			return result, nil
+		}
+	}
+
+	result.StepError = t.applySanction(chat, user, step.Action, time.Duration(step.Duration)*time.Second)
+	if result.StepError != nil {
+		zap.L().Error("Не удалось применить наказание",
+			zap.Error(result.StepError),
+			zap.Int64("chat_id", chat.ID),
+			zap.Int64("user_id", user.ID),
+			zap.String("action", step.Action))
+		return result, nil
+	}
+
+	// Наказание по лестнице выносит бот, даже если предупреждение выдал администратор
+	t.logAction(&database.ModerationAction{
+		ChatID:   chat.ID,
+		TargetID: user.ID,
+		Action:   step.Action,
+		Duration: step.Duration,
+		Rule:     fmt.Sprintf("предупреждений: %d", count),
+	})
+
+	return result, nil
+}
+
+// parseWarnLadder разбирает лестницу наказаний вида "3=mute:1h 5=kick 7=ban" или "7=ban:30d"
+func parseWarnLadder(args []string) ([]database.WarnStep, error) {
+	ladder := make([]database.WarnStep, 0, len(args))
+	seen := map[int]bool{}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid ladder step %q", arg)
+		}
+
+		count, err := strconv.Atoi(parts[0])
+		if err != nil || count <= 0 || seen[count] {
+			return nil, fmt.Errorf("invalid warn count in %q", arg)
+		}
+		seen[count] = true
+
+		action, durationStr, _ := strings.Cut(strings.ToLower(parts[1]), ":")
+		if _, ok := sanctionNames[action]; !ok {
+			return nil, fmt.Errorf("unknown sanction in %q", arg)
+		}
+
+		step := database.WarnStep{Count: count, Action: action}
+		if durationStr != "" {
+			if action == database.SanctionKick {
+				return nil, fmt.Errorf("kick has no duration in %q", arg)
+			}
+			duration, err := parseDuration(durationStr)
+			if err != nil {
+				return nil, err
+			}
+			step.Duration = int64(duration / time.Second)
+		}
+
+		ladder = append(ladder, step)
+	}
+
+	sort.Slice(ladder, func(i, j int) bool {
+		return ladder[i].Count < ladder[j].Count
+	})
+
+	return ladder, nil
+}
+
+// formatWarnLadder выводит лестницу наказаний в читаемом виде
+func formatWarnLadder(ladder []database.WarnStep) string {
+	if len(ladder) == 0 {
+		return "Наказаний за предупреждения нет\n"
+	}
+
+	var b strings.Builder
+	for _, step := range ladder {
+		b.WriteString(fmt.Sprintf("%d - %s\n", step.Count, formatSanction(step.Action, time.Duration(step.Duration)*time.Second)))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"reflect"
+	"testing"
+)
+
+func TestParseWarnLadder(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []database.WarnStep
+		wantErr bool
+	}{
+		{
+			args: []string{"3=mute:1h", "5=kick", "7=ban"},
+			want: []database.WarnStep{
+				{Count: 3, Action: database.SanctionMute, Duration: 3600},
+				{Count: 5, Action: database.SanctionKick},
+				{Count: 7, Action: database.SanctionBan},
+			},
+		},
+		{
+			args: []string{"7=BAN:30d", "2=Mute:10m"},
+			want: []database.WarnStep{
+				{Count: 2, Action: database.SanctionMute, Duration: 600},
+				{Count: 7, Action: database.SanctionBan, Duration: 30 * 24 * 3600},
+			},
+		},
+		{args: []string{}, want: []database.WarnStep{}},
+		{args: []string{"3"}, wantErr: true},
+		{args: []string{"0=ban"}, wantErr: true},
+		{args: []string{"x=ban"}, wantErr: true},
+		{args: []string{"3=mute", "3=ban"}, wantErr: true},
+		{args: []string{"3=warn"}, wantErr: true},
+		{args: []string{"3=kick:1h"}, wantErr: true},
+		{args: []string{"3=mute:1y"}, wantErr: true},
+		{args: []string{"3=ban:400d"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWarnLadder(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseWarnLadder(%q) = %v, want error", tt.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseWarnLadder(%q) error: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWarnLadder(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWarnStepFor(t *testing.T) {
+	ladder := []database.WarnStep{
+		{Count: 3, Action: database.SanctionMute, Duration: 3600},
+		{Count: 5, Action: database.SanctionKick},
+		{Count: 7, Action: database.SanctionBan},
+	}
+
+	tests := []struct {
+		ladder []database.WarnStep
+		count  int
+		want   int // Count найденной ступени, 0 - ступени нет
+	}{
+		{ladder: ladder, count: 1, want: 0},
+		{ladder: ladder, count: 3, want: 3},
+		{ladder: ladder, count: 4, want: 0},
+		{ladder: ladder, count: 5, want: 5},
+		{ladder: ladder, count: 7, want: 7},
+		{ladder: ladder, count: 12, want: 7},
+		{ladder: nil, count: 3, want: 0},
+		{ladder: []database.WarnStep{}, count: 100, want: 0},
+	}
+
+	for _, tt := range tests {
+		step, ok := warnStepFor(tt.ladder, tt.count)
+		if ok != (tt.want != 0) || step.Count != tt.want {
+			t.Errorf("warnStepFor(%v, %d) = %v, %v, want step %d", tt.ladder, tt.count, step, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package telegram
+
+import (
+	"app/gateway/database"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Типы записей белого списка ссылок
+const (
+	whitelistDomain   = "domain"   // домен вместе со всеми поддоменами
+	whitelistPrefix   = "prefix"   // начало адреса: домен и путь до границы сегмента
+	whitelistUsername = "username" // телеграм-юзернейм: @name и ссылки t.me/name
+	whitelistRegexp   = "regexp"   // регулярное выражение по нормализованному адресу
+)
+
+var (
+	usernameRe = regexp.MustCompile(`^[a-z0-9_]{4,32}$`)
+	domainRe   = regexp.MustCompile(`^(?:[a-z0-9-]+\.)+[a-z]{2,}$`)
+
+	// Скомпилированные регулярные выражения белых списков, чтобы не компилировать их на каждое сообщение
+	whitelistRegexpCache sync.Map
+)
+
+// Домены, которые телеграм использует для ссылок на чаты и каналы
+var telegramHosts = map[string]bool{
+	"t.me":            true,
+	"telegram.me":     true,
+	"telegram.dog":    true,
+	"www.t.me":        true,
+	"www.telegram.me": true,
+}
+
+// Подсказка по формату записей белого списка
+const whitelistHelp = "Форматы записей:\n" +
+	"@name - телеграм-юзернейм (упоминания и ссылки t.me/name)\n" +
+	"example.com - домен вместе с поддоменами\n" +
+	"t.me/channel или example.com/path - адреса, начинающиеся с этого пути\n" +
+	"re:выражение - регулярное выражение по адресу без схемы, например re:^youtube\\.com/watch"
+
+// whitelistEntry запись белого списка ссылок
+type whitelistEntry struct {
+	Kind    string
+	Pattern string
+}
+
+// String возвращает запись в том виде, в котором ее можно снова передать в parseWhitelistEntry
+func (e whitelistEntry) String() string {
+	switch e.Kind {
+	case whitelistUsername:
+		return "@" + e.Pattern
+	case whitelistRegexp:
+		return "re:" + e.Pattern
+	}
+
+	return e.Kind + ":" + e.Pattern
+}
+
+// parseWhitelistEntry разбирает и проверяет запись белого списка. Поддерживаемые форматы:
+//
+//	@name, user:name            - телеграм-юзернейм
+//	example.com, domain:example.com - домен с поддоменами
+//	t.me/channel, prefix:example.com/path - начало адреса
+//	re:выражение, /выражение/   - регулярное выражение
+func parseWhitelistEntry(value string) (whitelistEntry, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return whitelistEntry{}, fmt.Errorf("empty whitelist entry")
+	}
+
+	kind, pattern := "", value
+	if idx := strings.Index(value, ":"); idx > 0 {
+		switch strings.ToLower(value[:idx]) {
+		case "user", whitelistUsername:
+			kind, pattern = whitelistUsername, value[idx+1:]
+		case whitelistDomain:
+			kind, pattern = whitelistDomain, value[idx+1:]
+		case whitelistPrefix:
+			kind, pattern = whitelistPrefix, value[idx+1:]
+		case "re", whitelistRegexp:
+			kind, pattern = whitelistRegexp, value[idx+1:]
+		}
+	}
+
+	if kind == "" {
+		switch {
+		case strings.HasPrefix(value, "@"):
+			kind = whitelistUsername
+		case len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+			kind, pattern = whitelistRegexp, value[1:len(value)-1]
+		case strings.Contains(value, "/"):
+			kind = whitelistPrefix
+		default:
+			kind = whitelistDomain
+		}
+	}
+
+	switch kind {
+	case whitelistUsername:
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "@"))
+		if !usernameRe.MatchString(pattern) {
+			return whitelistEntry{}, fmt.Errorf("invalid username %q", pattern)
+		}
+	case whitelistDomain:
+		host, _ := normalizeURL(pattern)
+		if !domainRe.MatchString(host) {
+			return whitelistEntry{}, fmt.Errorf("invalid domain %q", pattern)
+		}
+		pattern = host
+	case whitelistPrefix:
+		host, path := normalizeURL(pattern)
+		if !domainRe.MatchString(host) {
+			return whitelistEntry{}, fmt.Errorf("invalid url prefix %q", pattern)
+		}
+		pattern = host + path
+	case whitelistRegexp:
+		_, err := compileWhitelistRegexp(pattern)
+		if err != nil {
+			return whitelistEntry{}, fmt.Errorf("invalid regexp %q: %w", pattern, err)
+		}
+	}
+
+	return whitelistEntry{Kind: kind, Pattern: pattern}, nil
+}
+
+// compileWhitelistRegexp компилирует регулярное выражение без учета регистра, используя кэш
+func compileWhitelistRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := whitelistRegexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+	whitelistRegexpCache.Store(pattern, re)
+
+	return re, nil
+}
+
+// normalizeURL приводит ссылку к виду host и path: без схемы, www, порта, параметров
+// и завершающего слэша, в нижнем регистре. Домены телеграма приводятся к t.me
+func normalizeURL(raw string) (string, string) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if telegramHosts[host] {
+		host = "t.me"
+	}
+	path := strings.TrimRight(strings.ToLower(u.EscapedPath()), "/")
+
+	return host, path
+}
+
+// telegramUsername возвращает юзернейм, на который указывает найденная ссылка или упоминание
+func telegramUsername(finding linkFinding) string {
+	if finding.Type == linkMention {
+		return strings.ToLower(strings.TrimPrefix(finding.Value, "@"))
+	}
+
+	if strings.HasPrefix(strings.ToLower(finding.Value), "tg://resolve") {
+		u, err := url.Parse(finding.Value)
+		if err == nil {
+			return strings.ToLower(u.Query().Get("domain"))
+		}
+	}
+
+	host, path := normalizeURL(finding.Value)
+	if host != "t.me" {
+		return ""
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > 1 && segments[0] == "s" {
+		segments = segments[1:]
+	}
+	if usernameRe.MatchString(segments[0]) {
+		return segments[0]
+	}
+
+	return ""
+}
+
+// matches проверяет, разрешает ли запись белого списка найденную ссылку
+func (e whitelistEntry) matches(finding linkFinding) bool {
+	switch e.Kind {
+	case whitelistUsername:
+		return telegramUsername(finding) == e.Pattern
+	case whitelistRegexp:
+		re, err := compileWhitelistRegexp(e.Pattern)
+		if err != nil {
+			return false
+		}
+		if finding.Type == linkMention {
+			return re.MatchString(finding.Value)
+		}
+		host, path := normalizeURL(finding.Value)
+		return re.MatchString(host + path)
+	}
+
+	if finding.Type == linkMention || finding.Type == linkTextMention {
+		return false
+	}
+
+	host, path := normalizeURL(finding.Value)
+	switch e.Kind {
+	case whitelistDomain:
+		return host == e.Pattern || strings.HasSuffix(host, "."+e.Pattern)
+	case whitelistPrefix:
+		target := host + path
+		return target == e.Pattern || strings.HasPrefix(target, e.Pattern+"/")
+	}
+
+	return false
+}
+
+// groupWhitelist возвращает белый список ссылок группы
+func groupWhitelist(group *database.ModeratedGroup) []whitelistEntry {
+	entries := make([]whitelistEntry, 0, len(group.WhitelistedLinks))
+	for _, link := range group.WhitelistedLinks {
+		entries = append(entries, linkEntry(link))
+	}
+
+	return entries
+}
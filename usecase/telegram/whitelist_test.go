@@ -0,0 +1,102 @@
+package telegram
+
+import "testing"
+
+func TestParseWhitelistEntry(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    whitelistEntry
+		wantErr bool
+	}{
+		{value: "@Durov", want: whitelistEntry{Kind: whitelistUsername, Pattern: "durov"}},
+		{value: "user:telegram", want: whitelistEntry{Kind: whitelistUsername, Pattern: "telegram"}},
+		{value: "username:@telegram", want: whitelistEntry{Kind: whitelistUsername, Pattern: "telegram"}},
+		{value: "example.com", want: whitelistEntry{Kind: whitelistDomain, Pattern: "example.com"}},
+		{value: "https://WWW.Example.com/", want: whitelistEntry{Kind: whitelistPrefix, Pattern: "example.com"}},
+		{value: "domain:https://www.example.com:8080", want: whitelistEntry{Kind: whitelistDomain, Pattern: "example.com"}},
+		{value: "t.me/Channel", want: whitelistEntry{Kind: whitelistPrefix, Pattern: "t.me/channel"}},
+		{value: "telegram.me/channel/", want: whitelistEntry{Kind: whitelistPrefix, Pattern: "t.me/channel"}},
+		{value: "prefix:example.com/docs?page=1", want: whitelistEntry{Kind: whitelistPrefix, Pattern: "example.com/docs"}},
+		{value: "re:^youtube\\.com/watch", want: whitelistEntry{Kind: whitelistRegexp, Pattern: "^youtube\\.com/watch"}},
+		{value: "/github\\.com/", want: whitelistEntry{Kind: whitelistRegexp, Pattern: "github\\.com"}},
+		{value: "", wantErr: true},
+		{value: "   ", wantErr: true},
+		{value: "@abc", wantErr: true},
+		{value: "@bad-name", wantErr: true},
+		{value: "localhost", wantErr: true},
+		{value: "word", wantErr: true},
+		{value: "prefix:/path", wantErr: true},
+		{value: "re:(", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWhitelistEntry(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseWhitelistEntry(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseWhitelistEntry(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseWhitelistEntry(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWhitelistEntryString(t *testing.T) {
+	for _, value := range []string{"@durov", "domain:example.com", "prefix:t.me/channel", "re:^youtube\\.com/watch"} {
+		entry, err := parseWhitelistEntry(value)
+		if err != nil {
+			t.Errorf("parseWhitelistEntry(%q) error: %v", value, err)
+			continue
+		}
+		again, err := parseWhitelistEntry(entry.String())
+		if err != nil || again != entry {
+			t.Errorf("parseWhitelistEntry(%q) = %v, %v, want %v", entry.String(), again, err, entry)
+		}
+	}
+}
+
+func TestWhitelistEntryMatches(t *testing.T) {
+	tests := []struct {
+		entry   string
+		finding linkFinding
+		want    bool
+	}{
+		{entry: "example.com", finding: linkFinding{Type: linkURL, Value: "https://example.com/page"}, want: true},
+		{entry: "example.com", finding: linkFinding{Type: linkURL, Value: "docs.example.com"}, want: true},
+		{entry: "example.com", finding: linkFinding{Type: linkTextLink, Value: "http://WWW.EXAMPLE.COM"}, want: true},
+		{entry: "example.com", finding: linkFinding{Type: linkURL, Value: "https://notexample.com"}, want: false},
+		{entry: "example.com", finding: linkFinding{Type: linkURL, Value: "https://example.com.evil.io"}, want: false},
+		{entry: "example.com", finding: linkFinding{Type: linkMention, Value: "@examplecom"}, want: false},
+		{entry: "t.me/channel", finding: linkFinding{Type: linkURL, Value: "https://t.me/channel/123"}, want: true},
+		{entry: "t.me/channel", finding: linkFinding{Type: linkURL, Value: "https://telegram.me/Channel"}, want: true},
+		{entry: "t.me/channel", finding: linkFinding{Type: linkURL, Value: "https://t.me/channel2"}, want: false},
+		{entry: "t.me/channel", finding: linkFinding{Type: linkURL, Value: "https://t.me/other"}, want: false},
+		{entry: "@channel", finding: linkFinding{Type: linkMention, Value: "@Channel"}, want: true},
+		{entry: "@channel", finding: linkFinding{Type: linkURL, Value: "https://t.me/channel/5"}, want: true},
+		{entry: "@channel", finding: linkFinding{Type: linkURL, Value: "t.me/s/channel"}, want: true},
+		{entry: "@channel", finding: linkFinding{Type: linkURL, Value: "tg://resolve?domain=channel"}, want: true},
+		{entry: "@channel", finding: linkFinding{Type: linkMention, Value: "@channel_bot"}, want: false},
+		{entry: "@channel", finding: linkFinding{Type: linkURL, Value: "https://example.com/channel"}, want: false},
+		{entry: "re:^youtube\\.com/watch", finding: linkFinding{Type: linkURL, Value: "https://www.youtube.com/watch?v=1"}, want: true},
+		{entry: "re:^youtube\\.com/watch", finding: linkFinding{Type: linkURL, Value: "https://youtube.com/shorts/1"}, want: false},
+		{entry: "re:^@news_", finding: linkFinding{Type: linkMention, Value: "@news_daily"}, want: true},
+	}
+
+	for _, tt := range tests {
+		entry, err := parseWhitelistEntry(tt.entry)
+		if err != nil {
+			t.Errorf("parseWhitelistEntry(%q) error: %v", tt.entry, err)
+			continue
+		}
+		got := entry.matches(tt.finding)
+		if got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.entry, tt.finding, got, tt.want)
+		}
+	}
+}